@@ -0,0 +1,219 @@
+package common
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    ErrAPIKeyRequired    = errors.New("api key is required")
+    ErrAPIKeyInvalid     = errors.New("api key is invalid")
+    ErrAPIKeyExpired     = errors.New("api key is expired")
+    ErrAPIKeyNotFound    = errors.New("api key not found")
+    ErrAPIKeyScopeDenied = errors.New("api key is not allowed to access this resource")
+    ErrAPIKeyPrefixTaken = errors.New("api key prefix is taken by another key")
+)
+
+const (
+    // the prefix is 8 random bytes, so the prefixes of a large fleet don't collide
+    apiKeyPrefixSize = 16
+    apiKeySecretSize = 32
+    apiKeySeparator  = "."
+)
+
+// DeviceAPIKey is the stored form of a device api key,
+// only the prefix is kept in plain text so the key can be looked up
+type DeviceAPIKey struct {
+    Prefix   string
+    Hash     string
+    DeviceID string
+    TenantID string
+    Scopes   []string
+    // ExpiresAt is zero for keys that never expire
+    ExpiresAt time.Time
+}
+
+// HasScope checks if the key was granted the scope
+func (k *DeviceAPIKey) HasScope(scope string) bool {
+    return slices.Contains(k.Scopes, scope)
+}
+
+// Expired checks if the key is expired at the given time
+func (k *DeviceAPIKey) Expired(now time.Time) bool {
+    return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+// Device is the authenticated device that APIKeyMiddleware sets in the context
+type Device struct {
+    ID        string
+    TenantID  string
+    KeyPrefix string
+    Scopes    []string
+}
+
+// DeviceFromContext returns the device authenticated by APIKeyMiddleware
+func DeviceFromContext(ctx context.Context) (*Device, bool) {
+    device, ok := ctx.Value(DeviceContextKey).(*Device)
+    return device, ok
+}
+
+// APIKeyStore looks up the stored api keys by their prefix
+type APIKeyStore interface {
+    // FindAPIKey returns ErrAPIKeyNotFound if there is no key with the prefix
+    FindAPIKey(ctx context.Context, prefix string) (*DeviceAPIKey, error)
+}
+
+// MemoryAPIKeyStore is an in-memory APIKeyStore, useful for tests and a handful of static devices
+type MemoryAPIKeyStore struct {
+    sync.RWMutex
+
+    keys map[string]*DeviceAPIKey
+}
+
+// NewMemoryAPIKeyStore creates a new MemoryAPIKeyStore, the keys must have distinct prefixes
+func NewMemoryAPIKeyStore(keys ...*DeviceAPIKey) (*MemoryAPIKeyStore, error) {
+    store := &MemoryAPIKeyStore{keys: make(map[string]*DeviceAPIKey, len(keys))}
+    for _, key := range keys {
+        if err := store.Add(key); err != nil {
+            return nil, err
+        }
+    }
+    return store, nil
+}
+
+// Add adds the key or replaces the same key, a different key with the same prefix is ErrAPIKeyPrefixTaken
+// since the lookup would return the wrong device
+func (s *MemoryAPIKeyStore) Add(key *DeviceAPIKey) error {
+    s.Lock()
+    defer s.Unlock()
+    if existing, ok := s.keys[key.Prefix]; ok && existing.Hash != key.Hash {
+        return ErrAPIKeyPrefixTaken
+    }
+    s.keys[key.Prefix] = key
+    return nil
+}
+
+// FindAPIKey implements APIKeyStore
+func (s *MemoryAPIKeyStore) FindAPIKey(_ context.Context, prefix string) (*DeviceAPIKey, error) {
+    s.RLock()
+    defer s.RUnlock()
+    key, ok := s.keys[prefix]
+    if !ok {
+        return nil, ErrAPIKeyNotFound
+    }
+    return key, nil
+}
+
+func randomHex(size int) (string, error) {
+    buf := make([]byte, size)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
+
+// GenerateAPIKey generates a new api key for the device, the plain key is returned
+// only once and must be given to the device, the DeviceAPIKey is what should be stored
+func GenerateAPIKey(deviceID, pepper string, scopes []string, expiresAt time.Time) (string, *DeviceAPIKey, error) {
+    prefix, err := randomHex(apiKeyPrefixSize / 2)
+    if err != nil {
+        return "", nil, err
+    }
+    secret, err := randomHex(apiKeySecretSize / 2)
+    if err != nil {
+        return "", nil, err
+    }
+
+    key := prefix + apiKeySeparator + secret
+
+    return key, &DeviceAPIKey{
+        Prefix:    prefix,
+        Hash:      HashAPIKey(key, pepper),
+        DeviceID:  deviceID,
+        Scopes:    scopes,
+        ExpiresAt: expiresAt,
+    }, nil
+}
+
+// splitAPIKey returns the lookup prefix of the key
+func splitAPIKey(key string) (string, bool) {
+    prefix, secret, ok := strings.Cut(key, apiKeySeparator)
+    if !ok || prefix == "" || secret == "" {
+        return "", false
+    }
+    return prefix, true
+}
+
+// APIKeyMiddleware authenticates devices by the X-API-Key header
+// and sets the device in the context, every given scope is required
+func APIKeyMiddleware(store APIKeyStore, pepper string, scopes ...string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set(ContentType, ApplicationJSON)
+
+                key := r.Header.Get(XAPIKey)
+                if key == "" {
+                    HandleError(http.StatusUnauthorized, w, ErrAPIKeyRequired)
+                    return
+                }
+
+                prefix, ok := splitAPIKey(key)
+                if !ok {
+                    HandleError(http.StatusUnauthorized, w, ErrAPIKeyInvalid)
+                    return
+                }
+
+                stored, err := store.FindAPIKey(r.Context(), prefix)
+                if errors.Is(err, ErrAPIKeyNotFound) {
+                    HandleError(http.StatusUnauthorized, w, ErrAPIKeyInvalid)
+                    return
+                }
+                if err != nil {
+                    HandleError(http.StatusInternalServerError, w, err)
+                    return
+                }
+
+                if !CheckAPIKeyHash(key, pepper, stored.Hash) {
+                    HandleError(http.StatusUnauthorized, w, ErrAPIKeyInvalid)
+                    return
+                }
+
+                if stored.Expired(time.Now()) {
+                    HandleError(http.StatusUnauthorized, w, ErrAPIKeyExpired)
+                    return
+                }
+
+                for _, scope := range scopes {
+                    if !stored.HasScope(scope) {
+                        HandleError(http.StatusForbidden, w, ErrAPIKeyScopeDenied)
+                        return
+                    }
+                }
+
+                ctx := context.WithValue(r.Context(), DeviceContextKey, &Device{
+                    ID:        stored.DeviceID,
+                    TenantID:  stored.TenantID,
+                    KeyPrefix: stored.Prefix,
+                    Scopes:    stored.Scopes,
+                })
+
+                // keys issued for a tenant identify the tenant as well
+                if stored.TenantID != "" {
+                    ctx = WithTenant(ctx, stored.TenantID)
+                }
+
+                r = r.WithContext(ctx)
+
+                next.ServeHTTP(w, r)
+            },
+        )
+    }
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+const apiKeyPepper = "device-key-pepper"
+
+func serveAPIKey(store APIKeyStore, key string, scopes ...string) *httptest.ResponseRecorder {
+    handler := APIKeyMiddleware(store, apiKeyPepper, scopes...)(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                if _, ok := DeviceFromContext(r.Context()); !ok {
+                    w.WriteHeader(http.StatusInternalServerError)
+                    return
+                }
+                w.WriteHeader(http.StatusOK)
+            },
+        ),
+    )
+    r := httptest.NewRequest(http.MethodPost, "/positions", nil)
+    if key != "" {
+        r.Header.Set(XAPIKey, key)
+    }
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+    return w
+}
+
+func TestCheckAPIKeyHash(t *testing.T) {
+    hash := HashAPIKey("key", apiKeyPepper)
+    if !CheckAPIKeyHash("key", apiKeyPepper, hash) {
+        t.Fatal("Api key hash should be valid")
+    }
+    if CheckAPIKeyHash("key", "other-pepper", hash) {
+        t.Fatal("Api key hash should be invalid with another pepper")
+    }
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+    key, stored, err := GenerateAPIKey("tracker-1", apiKeyPepper, []string{"positions:write"}, time.Time{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    store, err := NewMemoryAPIKeyStore(stored)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if w := serveAPIKey(store, key, "positions:write"); w.Code != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", w.Code)
+    }
+}
+
+func TestAPIKeyMiddleware_MustFail(t *testing.T) {
+    key, stored, err := GenerateAPIKey("tracker-1", apiKeyPepper, []string{"positions:write"}, time.Time{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    expiredKey, expired, err := GenerateAPIKey("tracker-2", apiKeyPepper, nil, time.Now().Add(-time.Minute))
+    if err != nil {
+        t.Fatal(err)
+    }
+    store, err := NewMemoryAPIKeyStore(stored, expired)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name   string
+        key    string
+        scopes []string
+        status int
+    }{
+        {"missing", "", nil, http.StatusUnauthorized},
+        {"malformed", "no-separator", nil, http.StatusUnauthorized},
+        {"unknown prefix", "0000000000000000.secret", nil, http.StatusUnauthorized},
+        {"wrong secret", stored.Prefix + ".secret", nil, http.StatusUnauthorized},
+        {"expired", expiredKey, nil, http.StatusUnauthorized},
+        {"scope", key, []string{"vehicles:delete"}, http.StatusForbidden},
+    }
+
+    for _, test := range tests {
+        t.Run(
+            test.name, func(t *testing.T) {
+                if w := serveAPIKey(store, test.key, test.scopes...); w.Code != test.status {
+                    t.Fatalf("Status should be %d, got %d", test.status, w.Code)
+                }
+            },
+        )
+    }
+}
+
+func TestMemoryAPIKeyStore_Add_MustFail(t *testing.T) {
+    _, stored, err := GenerateAPIKey("tracker-1", apiKeyPepper, nil, time.Time{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(stored.Prefix) != apiKeyPrefixSize {
+        t.Fatalf("Prefix should be %d hex chars, got %s", apiKeyPrefixSize, stored.Prefix)
+    }
+    store, err := NewMemoryAPIKeyStore(stored)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // the same key can be added again, another key with its prefix can't
+    if err := store.Add(stored); err != nil {
+        t.Fatal(err)
+    }
+    other := &DeviceAPIKey{Prefix: stored.Prefix, Hash: HashAPIKey("other", apiKeyPepper), DeviceID: "tracker-2"}
+    if err := store.Add(other); !errors.Is(err, ErrAPIKeyPrefixTaken) {
+        t.Fatalf("Duplicate prefix should be rejected, got %v", err)
+    }
+    if key, _ := store.FindAPIKey(context.Background(), stored.Prefix); key.DeviceID != "tracker-1" {
+        t.Fatalf("Key should not be replaced, got %s", key.DeviceID)
+    }
+}
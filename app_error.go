@@ -0,0 +1,198 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "maps"
+    "net/http"
+    "slices"
+    "strings"
+    "sync"
+
+    "github.com/go-playground/validator/v10"
+)
+
+// AppError is an error that is safe to send to clients, with a stable code and the http status,
+// the internal cause is logged but never sent
+type AppError struct {
+    // Code is stable and machine-readable, like vehicle_not_found
+    Code   string
+    Status int
+    // Message is safe to show to the client
+    Message string
+    // Cause is the internal error, like the error of the database
+    Cause   error
+    Details map[string]any
+}
+
+var (
+    ErrBadRequest   = NewAppError("bad_request", http.StatusBadRequest, "The request is invalid")
+    ErrUnauthorized = NewAppError("unauthorized", http.StatusUnauthorized, "Authentication is required")
+    ErrForbidden    = NewAppError("forbidden", http.StatusForbidden, "Access is denied")
+    ErrNotFound     = NewAppError("not_found", http.StatusNotFound, "The resource was not found")
+    ErrConflict     = NewAppError("conflict", http.StatusConflict, "The resource already exists")
+    ErrValidation   = NewAppError("validation_failed", http.StatusBadRequest, "Validation failed")
+    ErrTimeout      = NewAppError("timeout", http.StatusGatewayTimeout, "The request timed out")
+    ErrInternal     = NewAppError("internal_error", http.StatusInternalServerError, "Internal server error")
+)
+
+// NewAppError creates a new app error, like so: NewAppError("vehicle_not_found", 404, "Vehicle not found")
+func NewAppError(code string, status int, message string) *AppError {
+    return &AppError{Code: code, Status: status, Message: message}
+}
+
+func (e *AppError) Error() string {
+    if e.Cause != nil {
+        return e.Code + ": " + e.Message + ": " + e.Cause.Error()
+    }
+    return e.Code + ": " + e.Message
+}
+
+func (e *AppError) Unwrap() error {
+    return e.Cause
+}
+
+// Is matches app errors by their code, so errors.Is(err, ErrNotFound) holds for the wrapped copies
+func (e *AppError) Is(target error) bool {
+    var appErr *AppError
+    return errors.As(target, &appErr) && appErr.Code == e.Code
+}
+
+// Wrap returns a copy of the error with the internal cause, like so: ErrNotFound.Wrap(sql.ErrNoRows)
+func (e *AppError) Wrap(cause error) *AppError {
+    wrapped := *e
+    wrapped.Cause = cause
+    return &wrapped
+}
+
+// WithDetails returns a copy of the error with the details that are sent to the client
+func (e *AppError) WithDetails(details map[string]any) *AppError {
+    detailed := *e
+    detailed.Details = maps.Clone(details)
+    return &detailed
+}
+
+// FieldErrors are the messages of the fields that failed a check the validator doesn't run, like the params
+// of ParseListQuery, they are rendered like validator.ValidationErrors, like so: ErrValidation.Wrap(errs)
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+    messages := make([]string, 0, len(e))
+    for _, field := range slices.Sorted(maps.Keys(e)) {
+        messages = append(messages, field+": "+e[field])
+    }
+    return strings.Join(messages, "; ")
+}
+
+// registeredError maps the errors that match the target to the app error
+type registeredError struct {
+    target error
+    appErr *AppError
+}
+
+// publicError registers a sentinel error of the package, its message is already safe to send
+func publicError(target error, code string, status int) registeredError {
+    return registeredError{target: target, appErr: NewAppError(code, status, target.Error())}
+}
+
+var errorRegistry = struct {
+    sync.RWMutex
+    entries []registeredError
+}{
+    entries: []registeredError{
+        publicError(ErrSignatureMismatch, "signature_mismatch", http.StatusBadRequest),
+        publicError(ErrSignatureExpired, "signature_expired", http.StatusBadRequest),
+        publicError(ErrSignatureNonceRequired, "signature_nonce_required", http.StatusBadRequest),
+        publicError(ErrSignatureReplayed, "signature_replayed", http.StatusBadRequest),
+        publicError(ErrUnsupportedSignatureVersion, "unsupported_signature_version", http.StatusBadRequest),
+        publicError(ErrRequestBodyTooLarge, "request_body_too_large", http.StatusRequestEntityTooLarge),
+        publicError(ErrBodyDigestMismatch, "body_digest_mismatch", http.StatusBadRequest),
+        publicError(ErrUnknownSignatureKey, "unknown_signature_key", http.StatusUnauthorized),
+        publicError(ErrTenantRequired, "tenant_required", http.StatusBadRequest),
+        publicError(ErrInvalidTenant, "invalid_tenant", http.StatusBadRequest),
+        publicError(ErrAPIKeyRequired, "api_key_required", http.StatusUnauthorized),
+        publicError(ErrAPIKeyInvalid, "api_key_invalid", http.StatusUnauthorized),
+        publicError(ErrAPIKeyExpired, "api_key_expired", http.StatusUnauthorized),
+        publicError(ErrAPIKeyScopeDenied, "api_key_scope_denied", http.StatusForbidden),
+        publicError(ErrPeerCertificateRequired, "peer_certificate_required", http.StatusUnauthorized),
+        publicError(ErrPeerNotAllowed, "peer_not_allowed", http.StatusForbidden),
+        publicError(ErrTokenExpired, "token_expired", http.StatusUnauthorized),
+        publicError(ErrorInvalidToken, "token_invalid", http.StatusUnauthorized),
+        // the api key is not found when it is invalid, the client must not tell them apart
+        {
+            target: ErrAPIKeyNotFound,
+            appErr: NewAppError("api_key_invalid", http.StatusUnauthorized, ErrAPIKeyInvalid.Error()),
+        },
+        {target: context.DeadlineExceeded, appErr: ErrTimeout},
+    },
+}
+
+// RegisterError maps the errors that match the target to the app error, so the services don't have to wrap
+// the errors of their dependencies, like so: RegisterError(sql.ErrNoRows, ErrNotFound)
+func RegisterError(target error, appErr *AppError) {
+    errorRegistry.Lock()
+    defer errorRegistry.Unlock()
+    // the latest registration wins, so services can override the defaults
+    errorRegistry.entries = append([]registeredError{{target, appErr}}, errorRegistry.entries...)
+}
+
+// lookupAppError finds the app error of err, false if it is not known
+func lookupAppError(err error) (*AppError, bool) {
+    var appErr *AppError
+    if errors.As(err, &appErr) {
+        return appErr, true
+    }
+
+    var validationErrors validator.ValidationErrors
+    var fieldErrors FieldErrors
+    if errors.As(err, &validationErrors) || errors.As(err, &fieldErrors) {
+        return ErrValidation.Wrap(err), true
+    }
+
+    errorRegistry.RLock()
+    defer errorRegistry.RUnlock()
+    for _, entry := range errorRegistry.entries {
+        if errors.Is(err, entry.target) {
+            return entry.appErr.Wrap(err), true
+        }
+    }
+    return nil, false
+}
+
+// MapError maps any error to an app error, unknown errors are internal errors
+// whose message is never sent to the client
+func MapError(err error) *AppError {
+    if appErr, ok := lookupAppError(err); ok {
+        return appErr
+    }
+    return ErrInternal.Wrap(err)
+}
+
+// resolveAppError maps the error like MapError, the status of the caller wins if it is set,
+// unknown client errors get the text of the status, only the app errors carry their own message
+func resolveAppError(statusCode int, err error) *AppError {
+    appErr, ok := lookupAppError(err)
+    switch {
+    case !ok && statusCode > 0 && statusCode < http.StatusInternalServerError:
+        return &AppError{
+            Code:    statusErrorCode(statusCode),
+            Status:  statusCode,
+            Message: http.StatusText(statusCode),
+            Cause:   err,
+        }
+    case !ok:
+        appErr = ErrInternal.Wrap(err)
+    }
+
+    if statusCode > 0 && statusCode != appErr.Status {
+        overridden := *appErr
+        overridden.Status = statusCode
+        return &overridden
+    }
+    return appErr
+}
+
+// statusErrorCode returns the code of the status, like not_found for 404
+func statusErrorCode(statusCode int) string {
+    return strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+}
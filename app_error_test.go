@@ -0,0 +1,120 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/goccy/go-json"
+)
+
+var errTestNoRows = errors.New("sql: no rows in result set")
+
+func decodeTestResponse(t *testing.T, w *httptest.ResponseRecorder) *Response {
+    var response Response
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    return &response
+}
+
+// restoreTestErrorRegistry restores the registered errors after the test, the registry is global
+func restoreTestErrorRegistry(t *testing.T) {
+    errorRegistry.RLock()
+    entries := errorRegistry.entries
+    errorRegistry.RUnlock()
+    t.Cleanup(
+        func() {
+            errorRegistry.Lock()
+            defer errorRegistry.Unlock()
+            errorRegistry.entries = entries
+        },
+    )
+}
+
+func TestMapError(t *testing.T) {
+    ErrVehicleNotFound := NewAppError("vehicle_not_found", http.StatusNotFound, "Vehicle not found")
+    restoreTestErrorRegistry(t)
+    RegisterError(errTestNoRows, ErrNotFound)
+
+    tests := []struct {
+        err    error
+        code   string
+        status int
+    }{
+        {ErrVehicleNotFound.Wrap(errTestNoRows), "vehicle_not_found", http.StatusNotFound},
+        {fmt.Errorf("find vehicle: %w", errTestNoRows), "not_found", http.StatusNotFound},
+        {fmt.Errorf("verify: %w", ErrSignatureReplayed), "signature_replayed", http.StatusBadRequest},
+        {context.DeadlineExceeded, "timeout", http.StatusGatewayTimeout},
+        {errors.New("pq: connection refused"), "internal_error", http.StatusInternalServerError},
+    }
+
+    for _, test := range tests {
+        appErr := MapError(test.err)
+        if appErr.Code != test.code || appErr.Status != test.status {
+            t.Errorf(
+                "Error %v should map to %s %d, got %s %d", test.err, test.code, test.status, appErr.Code, appErr.Status,
+            )
+        }
+        if !errors.Is(appErr, test.err) {
+            t.Errorf("Error %v should be the cause", test.err)
+        }
+    }
+
+    if !errors.Is(ErrVehicleNotFound.Wrap(errTestNoRows), ErrVehicleNotFound) {
+        t.Fatal("Wrapped app errors should match by code")
+    }
+}
+
+func TestWriteError(t *testing.T) {
+    w := httptest.NewRecorder()
+    WriteError(w, errors.New("pq: password authentication failed for user \"fleet\""))
+
+    if w.Code != http.StatusInternalServerError {
+        t.Fatalf("Status should be 500, got %d", w.Code)
+    }
+    if w.Header().Get(ContentType) != ApplicationJSON {
+        t.Fatalf("Content type should be json, got %s", w.Header().Get(ContentType))
+    }
+    response := decodeTestResponse(t, w)
+    if response.Code != "internal_error" || response.Message != "Internal server error" {
+        t.Fatalf("Internal errors should not be sent, got %+v", response)
+    }
+
+    w = httptest.NewRecorder()
+    WriteError(w, ErrConflict.WithDetails(map[string]any{"vehicle_id": "v-1"}))
+
+    if w.Code != http.StatusConflict {
+        t.Fatalf("Status should be 409, got %d", w.Code)
+    }
+    response = decodeTestResponse(t, w)
+    details, ok := response.Error.(map[string]any)
+    if response.Code != "conflict" || !ok || details["vehicle_id"] != "v-1" {
+        t.Fatalf("Details should be sent, got %+v", response)
+    }
+}
+
+func TestHandleError_Status(t *testing.T) {
+    // the status of the caller wins and unknown client errors only get the text of the status
+    w := httptest.NewRecorder()
+    HandleError(http.StatusUnprocessableEntity, w, errors.New("pq: duplicate key value violates unique constraint"))
+
+    response := decodeTestResponse(t, w)
+    if w.Code != http.StatusUnprocessableEntity || response.Message != "Unprocessable Entity" {
+        t.Fatalf("Unknown client errors should not be sent, got %d %+v", w.Code, response)
+    }
+    if response.Code != "unprocessable_entity" {
+        t.Fatalf("Code should be derived from the status, got %s", response.Code)
+    }
+
+    w = httptest.NewRecorder()
+    HandleError(http.StatusInternalServerError, w, errors.New("dial tcp 10.0.0.1:5432"))
+
+    response = decodeTestResponse(t, w)
+    if response.Message != "Internal server error" {
+        t.Fatalf("Internal errors should not be sent, got %+v", response)
+    }
+}
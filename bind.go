@@ -0,0 +1,160 @@
+package common
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "net/http"
+    "reflect"
+    "strings"
+    "sync"
+
+    "github.com/go-playground/validator/v10"
+    "github.com/goccy/go-json"
+)
+
+var (
+    ErrEmptyBody     = NewAppError("empty_body", http.StatusBadRequest, "Request body is empty")
+    ErrMalformedJSON = NewAppError("malformed_json", http.StatusBadRequest, "Request body is not valid json")
+)
+
+// defaultValidator is shared by the binds without a validator, it caches the structs it has seen
+var defaultValidator = sync.OnceValue(NewValidator)
+
+// BindConfig configures how the request body is decoded
+type BindConfig struct {
+    // MaxBodySize limits the body, 10 MB by default, negative means unlimited
+    MaxBodySize int64
+    // DisallowUnknownFields rejects the fields the struct doesn't have
+    DisallowUnknownFields bool
+    // Validator validates the decoded struct, NewValidator by default
+    Validator *validator.Validate
+}
+
+// DecodeAndValidate decodes the json body into T and validates it, like so:
+// request, err := DecodeAndValidate[CreateVehicleRequest](r)
+// the body read by VerifySignatureMiddleware is reused, the errors are rendered by HandleError
+func DecodeAndValidate[T any](r *http.Request) (*T, error) {
+    return DecodeAndValidateWithConfig[T](r, &BindConfig{})
+}
+
+// DecodeAndValidateWithConfig decodes the json body into T and validates it with the config,
+// a nil config is the defaults of BindConfig
+func DecodeAndValidateWithConfig[T any](r *http.Request, config *BindConfig) (*T, error) {
+    if config == nil {
+        config = &BindConfig{}
+    }
+    body, err := readRequestBody(r, config.MaxBodySize)
+    if err != nil {
+        return nil, err
+    }
+    if len(bytes.TrimSpace(body)) == 0 {
+        return nil, ErrEmptyBody
+    }
+
+    decoder := json.NewDecoder(bytes.NewReader(body))
+    if config.DisallowUnknownFields {
+        decoder.DisallowUnknownFields()
+    }
+
+    var value T
+    if err := decoder.Decode(&value); err != nil {
+        return nil, malformedJSONError(reflect.TypeFor[T](), err)
+    }
+    // a second document after the first one is as malformed as a broken one
+    if decoder.More() {
+        return nil, ErrMalformedJSON
+    }
+
+    validate := config.Validator
+    if validate == nil {
+        validate = defaultValidator()
+    }
+    if err := validate.Struct(&value); err != nil {
+        return nil, err
+    }
+
+    return &value, nil
+}
+
+// BindJSON decodes and validates the body into T with the default BindConfig, the error response is written
+// if it fails, use DecodeAndValidateWithConfig to reject unknown fields or change the limit, like so:
+//
+//	request, ok := BindJSON[CreateVehicleRequest](w, r)
+//	if !ok {
+//	    return
+//	}
+func BindJSON[T any](w http.ResponseWriter, r *http.Request) (*T, bool) {
+    value, err := DecodeAndValidate[T](r)
+    if err != nil {
+        w.Header().Set(ContentType, ApplicationJSON)
+        WriteError(w, err)
+        return nil, false
+    }
+    return value, true
+}
+
+// readRequestBody returns the body stored by VerifySignatureMiddleware or reads it up to the limit
+func readRequestBody(r *http.Request, maxBodySize int64) ([]byte, error) {
+    if maxBodySize == 0 {
+        maxBodySize = defaultMaxBodySize
+    }
+
+    if body, ok := r.Context().Value(Body).([]byte); ok {
+        if maxBodySize > 0 && int64(len(body)) > maxBodySize {
+            return nil, ErrRequestBodyTooLarge
+        }
+        return body, nil
+    }
+
+    if r.Body == nil {
+        return nil, nil
+    }
+    reader := r.Body
+    if maxBodySize > 0 {
+        // the writer is not needed, the error is rendered by the caller
+        reader = http.MaxBytesReader(nil, r.Body, maxBodySize)
+    }
+
+    body, err := io.ReadAll(reader)
+    if err != nil {
+        // the body may be limited by the caller too, like VerifySignatureMiddleware does
+        var maxBytesErr *http.MaxBytesError
+        if errors.As(err, &maxBytesErr) {
+            return nil, ErrRequestBodyTooLarge
+        }
+        return nil, err
+    }
+    return body, nil
+}
+
+// malformedJSONError tells the client which field has the wrong type, the message of the decoder is not sent
+func malformedJSONError(t reflect.Type, err error) error {
+    var typeErr *json.UnmarshalTypeError
+    if errors.As(err, &typeErr) && typeErr.Field != "" {
+        return ErrMalformedJSON.Wrap(err).WithDetails(map[string]any{"field": jsonFieldPath(t, typeErr.Field)})
+    }
+    return ErrMalformedJSON.Wrap(err)
+}
+
+// jsonFieldPath names the path of struct fields by their json tags, like the keys of the validation errors
+func jsonFieldPath(t reflect.Type, path string) string {
+    names := strings.Split(path, ".")
+    for i, name := range names {
+        for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+            t = t.Elem()
+        }
+        if t.Kind() != reflect.Struct {
+            break
+        }
+        field, ok := t.FieldByName(name)
+        if !ok {
+            break
+        }
+        if jsonName := jsonTagName(field); jsonName != "" {
+            names[i] = jsonName
+        }
+        t = field.Type
+    }
+    return strings.Join(names, ".")
+}
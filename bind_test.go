@@ -0,0 +1,127 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/go-playground/validator/v10"
+)
+
+type CreateVehicleRequest struct {
+    Name     string `json:"name" validate:"required,min=3"`
+    Capacity int    `json:"capacity" validate:"gte=1"`
+}
+
+func newBindRequest(body string) *http.Request {
+    return httptest.NewRequest(http.MethodPost, "/vehicles", strings.NewReader(body))
+}
+
+func TestDecodeAndValidate(t *testing.T) {
+    request, err := DecodeAndValidate[CreateVehicleRequest](newBindRequest(`{"name": "truck", "capacity": 2}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if request.Name != "truck" || request.Capacity != 2 {
+        t.Fatalf("Request should be decoded, got %+v", request)
+    }
+
+    // the body read by VerifySignatureMiddleware is reused
+    r := newBindRequest("")
+    r = r.WithContext(context.WithValue(r.Context(), Body, []byte(`{"name": "van", "capacity": 1}`)))
+    request, err = DecodeAndValidate[CreateVehicleRequest](r)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if request.Name != "van" {
+        t.Fatalf("Body of the context should be used, got %+v", request)
+    }
+
+    // a nil config is the defaults
+    request, err = DecodeAndValidateWithConfig[CreateVehicleRequest](
+        newBindRequest(`{"name": "bus", "capacity": 3}`), nil,
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    if request.Name != "bus" {
+        t.Fatalf("Request should be decoded with a nil config, got %+v", request)
+    }
+}
+
+func TestDecodeAndValidate_MustFail(t *testing.T) {
+    tests := map[string]struct {
+        body   string
+        config *BindConfig
+        target error
+    }{
+        "empty":     {"", &BindConfig{}, ErrEmptyBody},
+        "malformed": {`{"name": `, &BindConfig{}, ErrMalformedJSON},
+        "type":      {`{"name": "truck", "capacity": "two"}`, &BindConfig{}, ErrMalformedJSON},
+        "trailing":  {`{"name": "truck", "capacity": 2} {}`, &BindConfig{}, ErrMalformedJSON},
+        "unknown": {
+            `{"name": "truck", "capacity": 2, "color": "red"}`,
+            &BindConfig{DisallowUnknownFields: true},
+            ErrMalformedJSON,
+        },
+        "too large": {`{"name": "truck", "capacity": 2}`, &BindConfig{MaxBodySize: 10}, ErrRequestBodyTooLarge},
+    }
+
+    for name, test := range tests {
+        t.Run(
+            name, func(t *testing.T) {
+                _, err := DecodeAndValidateWithConfig[CreateVehicleRequest](newBindRequest(test.body), test.config)
+                if !errors.Is(err, test.target) {
+                    t.Fatalf("Error should be %v, got %v", test.target, err)
+                }
+            },
+        )
+    }
+
+    _, err := DecodeAndValidate[CreateVehicleRequest](newBindRequest(`{"name": "ab"}`))
+    var validationErrors validator.ValidationErrors
+    if !errors.As(err, &validationErrors) {
+        t.Fatalf("Validation should fail, got %v", err)
+    }
+}
+
+func TestBindJSON(t *testing.T) {
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            if _, ok := BindJSON[CreateVehicleRequest](w, r); !ok {
+                return
+            }
+            w.WriteHeader(http.StatusCreated)
+        },
+    )
+
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, newBindRequest(`{"name": "ab", "capacity": 0}`))
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Status should be 400, got %d", w.Code)
+    }
+    response := decodeTestResponse(t, w)
+    messages, ok := response.Error.(map[string]any)
+    if response.Code != "validation_failed" || !ok || messages["name"] != "name must be at least 3 characters in length" {
+        t.Fatalf("Validation errors should be rendered, got %+v", response)
+    }
+
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, newBindRequest(`{"name": "truck", "capacity": "two"}`))
+
+    response = decodeTestResponse(t, w)
+    details, ok := response.Error.(map[string]any)
+    if w.Code != http.StatusBadRequest || response.Code != "malformed_json" || !ok || details["field"] != "capacity" {
+        t.Fatalf("Malformed json should be rendered, got %d %+v", w.Code, response)
+    }
+
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, newBindRequest(`{"name": "truck", "capacity": 2}`))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Status should be 201, got %d", w.Code)
+    }
+}
@@ -0,0 +1,232 @@
+// Command configschema prints the env vars a config struct expects, with their types, defaults and
+// validation rules, as a .env template, like so:
+//
+//	go run github.com/yemyoaung/managing-vehicle-tracking-common/cmd/configschema -dir ./config -type Config -prefix APP_ > .env.example
+//
+// the struct is read from the source of the package, so nested structs must be declared in the same package,
+// embedded structs of other packages are skipped with a warning on stderr,
+// the keys are built by common.ConfigKey and common.NestedConfigPrefix, like ConfigLoader builds them
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "go/ast"
+    "go/parser"
+    "go/token"
+    "go/types"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+
+    common "github.com/yemyoaung/managing-vehicle-tracking-common"
+)
+
+var ErrConfigTypeNotFound = errors.New("config type not found")
+
+// schemaField is a field of the config struct that is loaded from a single env var
+type schemaField struct {
+    Key        string
+    Namespace  string
+    Type       string
+    Default    string
+    HasDefault bool
+    Validate   string
+    Usage      string
+    Secret     bool
+}
+
+// parseStructs reads the struct types declared in the go files of the directory
+func parseStructs(dir string) (map[string]*ast.StructType, error) {
+    files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+    if err != nil {
+        return nil, err
+    }
+
+    structs := make(map[string]*ast.StructType)
+    fset := token.NewFileSet()
+    for _, file := range files {
+        if strings.HasSuffix(file, "_test.go") {
+            continue
+        }
+        parsed, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+        if err != nil {
+            return nil, err
+        }
+        ast.Inspect(
+            parsed, func(node ast.Node) bool {
+                if spec, ok := node.(*ast.TypeSpec); ok {
+                    if structType, ok := spec.Type.(*ast.StructType); ok {
+                        structs[spec.Name.Name] = structType
+                    }
+                }
+                return true
+            },
+        )
+    }
+    return structs, nil
+}
+
+// isRedacted checks if the type is Redacted[T] or common.Redacted[T], which are secrets without a tag
+func isRedacted(expr ast.Expr) bool {
+    index, ok := expr.(*ast.IndexExpr)
+    if !ok {
+        return false
+    }
+    switch generic := index.X.(type) {
+    case *ast.Ident:
+        return generic.Name == "Redacted"
+    case *ast.SelectorExpr:
+        return generic.Sel.Name == "Redacted"
+    }
+    return false
+}
+
+// collectFields walks the struct the way ConfigLoader decodes it, embedded structs declared in another package
+// cannot be read from the source, so they are reported to warnings and skipped
+func collectFields(
+    structs map[string]*ast.StructType,
+    structType *ast.StructType,
+    prefix, namespace string,
+    fields []schemaField,
+    warnings io.Writer,
+) []schemaField {
+    for _, field := range structType.Fields.List {
+        var tag reflect.StructTag
+        if field.Tag != nil {
+            unquoted, err := strconv.Unquote(field.Tag.Value)
+            if err == nil {
+                tag = reflect.StructTag(unquoted)
+            }
+        }
+
+        fieldType := field.Type
+        if star, ok := fieldType.(*ast.StarExpr); ok {
+            fieldType = star.X
+        }
+        var nested *ast.StructType
+        if ident, ok := fieldType.(*ast.Ident); ok {
+            nested = structs[ident.Name]
+        }
+
+        names := make([]string, 0, len(field.Names))
+        for _, name := range field.Names {
+            names = append(names, name.Name)
+        }
+        anonymous := len(names) == 0
+        if anonymous {
+            switch embedded := fieldType.(type) {
+            case *ast.Ident:
+                names = append(names, embedded.Name)
+            case *ast.SelectorExpr:
+                if embedded.Sel.IsExported() {
+                    _, _ = fmt.Fprintf(
+                        warnings, "skipping embedded %s in %s: declared in another package\n",
+                        types.ExprString(embedded), strings.TrimSuffix(namespace, "."),
+                    )
+                }
+                continue
+            default:
+                continue
+            }
+        }
+
+        for _, name := range names {
+            if !ast.IsExported(name) {
+                continue
+            }
+            structField := reflect.StructField{Name: name, Tag: tag, Anonymous: anonymous}
+            key := common.ConfigKey(structField)
+            if key == "-" {
+                continue
+            }
+
+            if nested != nil {
+                fields = collectFields(
+                    structs, nested, common.NestedConfigPrefix(prefix, structField), namespace+name+".", fields,
+                    warnings,
+                )
+                continue
+            }
+
+            defaultValue, hasDefault := tag.Lookup("default")
+            fields = append(
+                fields, schemaField{
+                    Key:        prefix + key,
+                    Namespace:  namespace + name,
+                    Type:       types.ExprString(field.Type),
+                    Default:    defaultValue,
+                    HasDefault: hasDefault,
+                    Validate:   tag.Get("validate"),
+                    Usage:      tag.Get("usage"),
+                    Secret:     tag.Get("secret") == "true" || isRedacted(fieldType),
+                },
+            )
+        }
+    }
+    return fields
+}
+
+// writeEnvTemplate writes a commented env var for every field, set to its default
+func writeEnvTemplate(w io.Writer, fields []schemaField, prefix string) error {
+    for _, field := range fields {
+        details := []string{field.Type}
+        // the default of a secret is not printed either, it would end up in the template
+        if field.HasDefault && !field.Secret {
+            details = append(details, "default: "+field.Default)
+        }
+        if field.Validate != "" {
+            details = append(details, "validate: "+field.Validate)
+        }
+        if field.Secret {
+            details = append(details, "secret")
+        }
+
+        comment := field.Namespace + " (" + strings.Join(details, ", ") + ")"
+        if field.Usage != "" {
+            comment += " " + field.Usage
+        }
+
+        // a secret never gets an example value, it should be a secret:// or file:// reference
+        value := field.Default
+        if field.Secret {
+            value = ""
+        }
+
+        if _, err := fmt.Fprintf(w, "# %s\n%s%s=%s\n", comment, prefix, field.Key, value); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// run prints the env template of the type declared in the directory, and the skipped fields to warnings
+func run(w, warnings io.Writer, dir, typeName, prefix string) error {
+    structs, err := parseStructs(dir)
+    if err != nil {
+        return err
+    }
+
+    structType, ok := structs[typeName]
+    if !ok {
+        return fmt.Errorf("%w: %s in %s", ErrConfigTypeNotFound, typeName, dir)
+    }
+
+    return writeEnvTemplate(w, collectFields(structs, structType, "", typeName+".", nil, warnings), prefix)
+}
+
+func main() {
+    dir := flag.String("dir", ".", "directory of the package that declares the config struct")
+    typeName := flag.String("type", "Config", "name of the config struct")
+    prefix := flag.String("prefix", "", "prefix of the env vars, like APP_")
+    flag.Parse()
+
+    if err := run(os.Stdout, os.Stderr, *dir, *typeName, *prefix); err != nil {
+        log.Fatal(err)
+    }
+}
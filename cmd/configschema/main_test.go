@@ -0,0 +1,77 @@
+package main
+
+import (
+    "errors"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+const testConfigSource = `package config
+
+import (
+    "time"
+
+    "example.com/shared"
+    "github.com/yemyoaung/managing-vehicle-tracking-common"
+)
+
+type Config struct {
+    Port      int           ` + "`env:\"PORT\" default:\"8080\" validate:\"required,min=1\" usage:\"port to listen on\"`" + `
+    Timeout   time.Duration ` + "`env:\"TIMEOUT\"`" + `
+    JwtSecret string        ` + "`env:\"JWT_SECRET\" default:\"changeme\" secret:\"true\"`" + `
+    APIKey    common.Redacted[string] ` + "`env:\"API_KEY\" default:\"dev-key\"`" + `
+    Database  Database      ` + "`env:\"DB\"`" + `
+    Base
+    shared.TLSConfig
+    internal  string
+}
+
+type Database struct {
+    Host string ` + "`env:\"HOST\" validate:\"required\"`" + `
+}
+
+type Base struct {
+    Name string
+}
+`
+
+func TestRun(t *testing.T) {
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "config.go"), []byte(testConfigSource), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    var out, warnings strings.Builder
+    if err := run(&out, &warnings, dir, "Config", "APP_"); err != nil {
+        t.Fatal(err)
+    }
+
+    expected := `# Config.Port (int, default: 8080, validate: required,min=1) port to listen on
+APP_PORT=8080
+# Config.Timeout (time.Duration)
+APP_TIMEOUT=
+# Config.JwtSecret (string, secret)
+APP_JWT_SECRET=
+# Config.APIKey (common.Redacted[string], secret)
+APP_API_KEY=
+# Config.Database.Host (string, validate: required)
+APP_DB_HOST=
+# Config.Base.Name (string)
+APP_Name=
+`
+    if out.String() != expected {
+        t.Fatalf("Template should be\n%s\ngot\n%s", expected, out.String())
+    }
+
+    expectedWarnings := "skipping embedded shared.TLSConfig in Config: declared in another package\n"
+    if warnings.String() != expectedWarnings {
+        t.Fatalf("Embedded structs of other packages should be reported, got %q", warnings.String())
+    }
+
+    if err := run(&out, io.Discard, dir, "Missing", ""); !errors.Is(err, ErrConfigTypeNotFound) {
+        t.Fatalf("Missing types should fail, got %v", err)
+    }
+}
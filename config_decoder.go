@@ -0,0 +1,351 @@
+package common
+
+import (
+    "encoding"
+    "errors"
+    "fmt"
+    "net/url"
+    "reflect"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var (
+    ErrInvalidConfigTarget   = errors.New("config must be a pointer to a struct")
+    ErrUnsupportedConfigType = errors.New("unsupported config field type")
+)
+
+const defaultConfigSeparator = ","
+
+var (
+    durationType        = reflect.TypeOf(time.Duration(0))
+    urlType             = reflect.TypeOf(url.URL{})
+    textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// configValues looks up the values by their exact key first and case-insensitively second,
+// like the json decoding ConfigLoader used before
+type configValues struct {
+    exact map[string]string
+    upper map[string]string
+}
+
+func newConfigValues(values map[string]string) *configValues {
+    upper := make(map[string]string, len(values))
+    for key, value := range values {
+        upper[strings.ToUpper(key)] = value
+    }
+    return &configValues{exact: values, upper: upper}
+}
+
+func (c *configValues) lookup(key string) (string, bool) {
+    if value, ok := c.exact[key]; ok {
+        return value, true
+    }
+    value, ok := c.upper[strings.ToUpper(key)]
+    return value, ok
+}
+
+// hasSection checks if a key of the nested struct is set, the values of the default tags
+// don't count, since DefaultsSource sets them whether the section is configured or not
+func (c *configValues) hasSection(t reflect.Type, prefix string) bool {
+    for _, field := range collectConfigFields(t, prefix, "", nil, nil) {
+        value, ok := c.lookup(field.Key)
+        if defaultValue, hasDefault := field.Field.Tag.Lookup("default"); ok && (!hasDefault || value != defaultValue) {
+            return true
+        }
+    }
+    return false
+}
+
+// ConfigKey returns the key of the field, from the env tag, the json tag or the field name
+func ConfigKey(field reflect.StructField) string {
+    if name, ok := field.Tag.Lookup("env"); ok {
+        return name
+    }
+    if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+        return name
+    }
+    return field.Name
+}
+
+// configPrefix returns the prefix of the keys of a nested struct,
+// from the envPrefix tag or the key of the field followed by an underscore
+func configPrefix(field reflect.StructField) string {
+    if prefix, ok := field.Tag.Lookup("envPrefix"); ok {
+        return prefix
+    }
+    return ConfigKey(field) + "_"
+}
+
+// NestedConfigPrefix returns the prefix of the keys of a nested struct below the prefix of its parent,
+// embedded structs without an envPrefix tag are flattened, like encoding/json does
+func NestedConfigPrefix(prefix string, field reflect.StructField) string {
+    if _, tagged := field.Tag.Lookup("envPrefix"); field.Anonymous && !tagged {
+        return prefix
+    }
+    return prefix + configPrefix(field)
+}
+
+// isNestedConfig checks if the fields of the type are decoded one by one,
+// types that decode themselves from a single value are not nested
+func isNestedConfig(t reflect.Type) bool {
+    if t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    return t.Kind() == reflect.Struct &&
+        t != urlType &&
+        !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// configField is a field of a config struct that is decoded from a single value
+type configField struct {
+    // Key is the full key, including the prefixes of the nested structs
+    Key string
+    // Namespace is the path of the field in the struct, like the validator's StructNamespace
+    Namespace string
+    // Index is the path of field indexes from the root struct, see configFieldValue
+    Index []int
+    Field reflect.StructField
+}
+
+// configFields returns the fields of the config struct in the order they are declared,
+// nested structs are walked the same way decodeConfig walks them
+func configFields(t reflect.Type) []configField {
+    if t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    return collectConfigFields(t, "", t.Name()+".", nil, nil)
+}
+
+func collectConfigFields(t reflect.Type, prefix, namespace string, index []int, fields []configField) []configField {
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if !field.IsExported() {
+            continue
+        }
+
+        key := ConfigKey(field)
+        if key == "-" {
+            continue
+        }
+
+        if isNestedConfig(field.Type) {
+            nestedType := field.Type
+            if nestedType.Kind() == reflect.Pointer {
+                nestedType = nestedType.Elem()
+            }
+            fields = collectConfigFields(
+                nestedType,
+                NestedConfigPrefix(prefix, field),
+                namespace+field.Name+".",
+                append(slices.Clone(index), i),
+                fields,
+            )
+            continue
+        }
+
+        fields = append(
+            fields, configField{
+                Key:       prefix + key,
+                Namespace: namespace + field.Name,
+                Index:     append(slices.Clone(index), i),
+                Field:     field,
+            },
+        )
+    }
+    return fields
+}
+
+// configNamespaceField returns the field at the namespace of the validator, like Config.Database,
+// and its key, built the way collectConfigFields builds the keys, it also finds the nested structs
+func configNamespaceField(t reflect.Type, namespace string) (reflect.StructField, string, bool) {
+    names := strings.Split(namespace, ".")
+    prefix := ""
+    for i := 1; i < len(names); i++ {
+        for t.Kind() == reflect.Pointer {
+            t = t.Elem()
+        }
+        if t.Kind() != reflect.Struct {
+            break
+        }
+        // the elements of slices are validated with dive, like Config.Ports[0]
+        name, _, _ := strings.Cut(names[i], "[")
+        field, ok := t.FieldByName(name)
+        if !ok {
+            break
+        }
+        if i == len(names)-1 || !isNestedConfig(field.Type) {
+            return field, prefix + ConfigKey(field), true
+        }
+        prefix = NestedConfigPrefix(prefix, field)
+        t = field.Type
+    }
+    return reflect.StructField{}, "", false
+}
+
+// configFieldValue returns the value of the field in the config struct,
+// false if a nested pointer struct on the way is nil
+func configFieldValue(v reflect.Value, field configField) (reflect.Value, bool) {
+    for _, i := range field.Index {
+        for v.Kind() == reflect.Pointer {
+            if v.IsNil() {
+                return reflect.Value{}, false
+            }
+            v = v.Elem()
+        }
+        v = v.Field(i)
+    }
+    return v, true
+}
+
+// decodeConfig decodes the values into the struct that out points to,
+// keys are matched with the env tags, like so: `env:"PORT"`
+//
+// supported are strings, bools, numbers, time.Duration, url.URL, encoding.TextUnmarshaler,
+// pointers, slices split by the envSeparator tag ("," by default) and nested structs
+// whose keys are prefixed by the envPrefix tag (the field key and "_" by default),
+// nested pointer structs are only allocated if one of their keys is set, see configValues.hasSection
+func decodeConfig(values map[string]string, out any) error {
+    v := reflect.ValueOf(out)
+    if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+        return ErrInvalidConfigTarget
+    }
+    return decodeStruct(newConfigValues(values), "", v.Elem())
+}
+
+func decodeStruct(values *configValues, prefix string, v reflect.Value) error {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if !field.IsExported() {
+            continue
+        }
+
+        key := ConfigKey(field)
+        if key == "-" {
+            continue
+        }
+
+        if isNestedConfig(field.Type) {
+            nestedPrefix := NestedConfigPrefix(prefix, field)
+            fieldValue := v.Field(i)
+            if fieldValue.Kind() == reflect.Pointer {
+                if fieldValue.IsNil() {
+                    // an optional section stays nil if none of its keys are set, so its fields are not validated
+                    if !values.hasSection(field.Type.Elem(), nestedPrefix) {
+                        continue
+                    }
+                    fieldValue.Set(reflect.New(field.Type.Elem()))
+                }
+                fieldValue = fieldValue.Elem()
+            }
+            if err := decodeStruct(values, nestedPrefix, fieldValue); err != nil {
+                return err
+            }
+            continue
+        }
+
+        raw, ok := values.lookup(prefix + key)
+        if !ok {
+            continue
+        }
+
+        separator := defaultConfigSeparator
+        if tag, ok := field.Tag.Lookup("envSeparator"); ok {
+            separator = tag
+        }
+
+        if err := decodeConfigValue(v.Field(i), raw, separator); err != nil {
+            return fmt.Errorf("%s%s: %w", prefix, key, err)
+        }
+    }
+    return nil
+}
+
+// decodeConfigValue sets the raw value on the field
+func decodeConfigValue(v reflect.Value, raw string, separator string) error {
+    if v.Kind() == reflect.Pointer {
+        value := reflect.New(v.Type().Elem())
+        if err := decodeConfigValue(value.Elem(), raw, separator); err != nil {
+            return err
+        }
+        v.Set(value)
+        return nil
+    }
+
+    if v.CanAddr() {
+        if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+            return unmarshaler.UnmarshalText([]byte(raw))
+        }
+    }
+
+    switch v.Type() {
+    case durationType:
+        duration, err := time.ParseDuration(raw)
+        if err != nil {
+            return err
+        }
+        v.SetInt(int64(duration))
+        return nil
+    case urlType:
+        parsed, err := url.Parse(raw)
+        if err != nil {
+            return err
+        }
+        v.Set(reflect.ValueOf(*parsed))
+        return nil
+    }
+
+    switch v.Kind() {
+    case reflect.String:
+        v.SetString(raw)
+    case reflect.Bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return err
+        }
+        v.SetBool(b)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetInt(n)
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetUint(n)
+    case reflect.Float32, reflect.Float64:
+        n, err := strconv.ParseFloat(raw, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetFloat(n)
+    case reflect.Slice:
+        // []byte is taken as is, other slices are split
+        if v.Type().Elem().Kind() == reflect.Uint8 {
+            v.SetBytes([]byte(raw))
+            return nil
+        }
+        if strings.TrimSpace(raw) == "" {
+            v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+            return nil
+        }
+        parts := strings.Split(raw, separator)
+        slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+        for i, part := range parts {
+            if err := decodeConfigValue(slice.Index(i), strings.TrimSpace(part), separator); err != nil {
+                return err
+            }
+        }
+        v.Set(slice)
+    default:
+        return fmt.Errorf("%w: %s", ErrUnsupportedConfigType, v.Type())
+    }
+    return nil
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+    "errors"
+    "net"
+    "net/url"
+    "reflect"
+    "testing"
+    "time"
+)
+
+type DatabaseConfig struct {
+    Host     string `env:"HOST"`
+    Port     int    `env:"PORT"`
+    MaxConns uint8  `env:"MAX_CONNS"`
+}
+
+type TypedConfig struct {
+    Port        int            `env:"PORT"`
+    Debug       bool           `env:"DEBUG"`
+    Ratio       float64        `env:"RATIO"`
+    Timeout     time.Duration  `env:"TIMEOUT"`
+    BrokerURL   url.URL        `env:"BROKER_URL"`
+    CallbackURL *url.URL       `env:"CALLBACK_URL"`
+    Origins     []string       `env:"ORIGINS"`
+    Ports       []int          `env:"PORTS" envSeparator:";"`
+    IP          net.IP         `env:"IP"`
+    StartedAt   time.Time      `env:"STARTED_AT"`
+    Retries     *int           `env:"RETRIES"`
+    Database    DatabaseConfig `env:"DB"`
+    Replica     DatabaseConfig `envPrefix:"REPLICA_DB_"`
+    Skipped     string         `env:"-"`
+    Name        string
+    unexported  string
+}
+
+func TestDecodeConfig(t *testing.T) {
+    var config TypedConfig
+    err := decodeConfig(
+        map[string]string{
+            "PORT":            "8080",
+            "DEBUG":           "true",
+            "RATIO":           "0.5",
+            "TIMEOUT":         "1m30s",
+            "BROKER_URL":      "amqp://localhost:5672/",
+            "CALLBACK_URL":    "https://example.com/hook",
+            "ORIGINS":         "https://a.example.com, https://b.example.com",
+            "PORTS":           "80;443",
+            "IP":              "10.0.0.1",
+            "STARTED_AT":      "2024-11-16T00:00:00Z",
+            "RETRIES":         "3",
+            "DB_HOST":         "db",
+            "DB_PORT":         "5432",
+            "DB_MAX_CONNS":    "20",
+            "REPLICA_DB_HOST": "replica",
+            "Skipped":         "value",
+            "NAME":            "vehicle-service",
+        }, &config,
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := TypedConfig{
+        Port:        8080,
+        Debug:       true,
+        Ratio:       0.5,
+        Timeout:     90 * time.Second,
+        BrokerURL:   url.URL{Scheme: "amqp", Host: "localhost:5672", Path: "/"},
+        CallbackURL: &url.URL{Scheme: "https", Host: "example.com", Path: "/hook"},
+        Origins:     []string{"https://a.example.com", "https://b.example.com"},
+        Ports:       []int{80, 443},
+        IP:          net.ParseIP("10.0.0.1"),
+        StartedAt:   time.Date(2024, 11, 16, 0, 0, 0, 0, time.UTC),
+        Database:    DatabaseConfig{Host: "db", Port: 5432, MaxConns: 20},
+        Replica:     DatabaseConfig{Host: "replica"},
+        Name:        "vehicle-service",
+    }
+    retries := 3
+    expected.Retries = &retries
+
+    if !reflect.DeepEqual(config, expected) {
+        t.Fatalf("Config should be %+v, got %+v", expected, config)
+    }
+}
+
+func TestDecodeConfig_MustFail(t *testing.T) {
+    tests := map[string]map[string]string{
+        "int":      {"PORT": "http"},
+        "bool":     {"DEBUG": "maybe"},
+        "duration": {"TIMEOUT": "10"},
+        "overflow": {"DB_MAX_CONNS": "256"},
+        "slice":    {"PORTS": "80;http"},
+    }
+
+    for name, values := range tests {
+        t.Run(
+            name, func(t *testing.T) {
+                var config TypedConfig
+                if err := decodeConfig(values, &config); err == nil {
+                    t.Fatal("Config should fail to decode")
+                }
+            },
+        )
+    }
+
+    var config TypedConfig
+    if err := decodeConfig(map[string]string{}, config); !errors.Is(err, ErrInvalidConfigTarget) {
+        t.Fatalf("Decoding into a non pointer should fail, got %v", err)
+    }
+}
+
+type OptionalDatabaseConfig struct {
+    Host string `env:"HOST" validate:"required"`
+    Port int    `env:"PORT" default:"5432"`
+}
+
+type OptionalSectionConfig struct {
+    Name     string                  `env:"NAME"`
+    Database *OptionalDatabaseConfig `env:"DB"`
+}
+
+func TestConfigLoader_OptionalSection(t *testing.T) {
+    // the default of the port alone doesn't configure the section
+    fileName := writeTestConfigFile(t, "config.yaml", "name: fleet\n")
+    loader, err := NewLayeredConfigLoader[OptionalSectionConfig](
+        nil, DefaultsSource[OptionalSectionConfig]{}, &FileSource{Path: fileName},
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    if loader.Config.Database != nil {
+        t.Fatalf("Absent section should stay nil, got %+v", loader.Config.Database)
+    }
+
+    fileName = writeTestConfigFile(t, "config.yaml", "name: fleet\ndb:\n  host: db\n")
+    loader, err = NewLayeredConfigLoader[OptionalSectionConfig](
+        nil, DefaultsSource[OptionalSectionConfig]{}, &FileSource{Path: fileName},
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    if database := loader.Config.Database; database == nil || database.Host != "db" || database.Port != 5432 {
+        t.Fatalf("Configured section should be decoded with its defaults, got %+v", database)
+    }
+
+    fileName = writeTestConfigFile(t, "config.yaml", "db:\n  port: 5433\n")
+    _, err = NewLayeredConfigLoader[OptionalSectionConfig](
+        nil, DefaultsSource[OptionalSectionConfig]{}, &FileSource{Path: fileName},
+    )
+    var report *ConfigValidationError
+    if !errors.As(err, &report) || report.Errors[0].Key != "DB_HOST" {
+        t.Fatalf("Partly configured section should be validated, got %v", err)
+    }
+}
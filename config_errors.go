@@ -0,0 +1,123 @@
+package common
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+    "strings"
+
+    "github.com/go-playground/validator/v10"
+)
+
+// ConfigFieldError is a field of the config that failed the validation
+type ConfigFieldError struct {
+    // Field is the path of the field in the struct, like Config.Database.Host
+    Field string
+    // Key is the env var of the field, with the prefix of the loader, like APP_DB_HOST
+    Key string
+    // Rule is the failed validation tag with its param, like oneof=debug info
+    Rule string
+    // Value is the value that was loaded, redacted if the field is a secret
+    Value string
+}
+
+func (e ConfigFieldError) String() string {
+    return fmt.Sprintf("%s (%s): failed %q, got %q", e.Key, e.Field, e.Rule, e.Value)
+}
+
+// ConfigValidationError reports every field of the config that failed the validation at once
+type ConfigValidationError struct {
+    Errors []ConfigFieldError
+    err    error
+}
+
+func (e *ConfigValidationError) Error() string {
+    var builder strings.Builder
+    builder.WriteString("invalid config:")
+    for _, field := range e.Errors {
+        builder.WriteString("\n  " + field.String())
+    }
+    return builder.String()
+}
+
+// Unwrap returns the validator.ValidationErrors, so callers can still inspect them
+func (e *ConfigValidationError) Unwrap() error {
+    return e.err
+}
+
+// configEnvPrefix returns the prefix of the env vars of the sources, the environment wins over the env files
+func configEnvPrefix(sources []ConfigSource) string {
+    prefix := ""
+    for _, source := range sources {
+        if envFile, ok := source.(*EnvFileSource); ok && prefix == "" {
+            prefix = envFile.Prefix
+        }
+    }
+    for _, source := range sources {
+        if env, ok := source.(*EnvSource); ok {
+            prefix = env.Prefix
+        }
+    }
+    return prefix
+}
+
+// newConfigValidationError maps the errors of the validator to the env vars of the config,
+// other errors are returned as is
+func newConfigValidationError[T any](config *T, prefix string, err error) error {
+    var validationErrors validator.ValidationErrors
+    if !errors.As(err, &validationErrors) {
+        return err
+    }
+
+    fields := make(map[string]configField)
+    for _, field := range configFields(reflect.TypeFor[T]()) {
+        fields[field.Namespace] = field
+    }
+
+    v := reflect.ValueOf(config).Elem()
+    report := &ConfigValidationError{err: err}
+    for _, fieldError := range validationErrors {
+        rule := fieldError.Tag()
+        if fieldError.Param() != "" {
+            rule += "=" + fieldError.Param()
+        }
+
+        // the elements of slices are validated with dive, like Config.Ports[0]
+        namespace, _, _ := strings.Cut(fieldError.StructNamespace(), "[")
+        field, ok := fields[namespace]
+        if !ok {
+            // nested structs are not config fields, like a required Config.Database
+            structField, key, found := configNamespaceField(reflect.TypeFor[T](), fieldError.StructNamespace())
+            if !found {
+                key = strings.ToUpper(fieldError.Field())
+            }
+            value := fmt.Sprint(fieldError.Value())
+            if found && isSecretField(structField) && value != "" {
+                value = redactedConfigValue
+            }
+            report.Errors = append(
+                report.Errors, ConfigFieldError{
+                    Field: fieldError.StructNamespace(),
+                    Key:   prefix + key,
+                    Rule:  rule,
+                    Value: value,
+                },
+            )
+            continue
+        }
+
+        var value string
+        if fieldValue, ok := configFieldValue(v, field); ok {
+            value = formatConfigField(field, fieldValue)
+        }
+        report.Errors = append(
+            report.Errors, ConfigFieldError{
+                Field: fieldError.StructNamespace(),
+                Key:   prefix + field.Key,
+                Rule:  rule,
+                Value: value,
+            },
+        )
+    }
+    return report
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/go-playground/validator/v10"
+)
+
+type ValidatedConfig struct {
+    Port      int            `env:"PORT" validate:"min=1"`
+    LogLevel  string         `env:"LOG_LEVEL" validate:"oneof=debug info"`
+    JwtSecret string         `env:"JWT_SECRET" secret:"true" validate:"min=32"`
+    Database  DatabaseConfig `env:"DB"`
+    Replica   ReplicaConfig  `envPrefix:"REPLICA_"`
+}
+
+type ReplicaConfig struct {
+    Host string `env:"HOST" validate:"required"`
+}
+
+func TestConfigValidationError(t *testing.T) {
+    envFile := writeTestConfigFile(t, ".env", "PORT=0\nLOG_LEVEL=verbose\nJWT_SECRET=too-short\n")
+
+    _, err := NewConfigLoaderFromEnvFile[ValidatedConfig](envFile, nil)
+
+    var report *ConfigValidationError
+    if !errors.As(err, &report) {
+        t.Fatalf("Error should be a config validation error, got %v", err)
+    }
+
+    expected := []ConfigFieldError{
+        {Field: "ValidatedConfig.Port", Key: "PORT", Rule: "min=1", Value: "0"},
+        {Field: "ValidatedConfig.LogLevel", Key: "LOG_LEVEL", Rule: "oneof=debug info", Value: "verbose"},
+        {Field: "ValidatedConfig.JwtSecret", Key: "JWT_SECRET", Rule: "min=32", Value: "[REDACTED]"},
+        {Field: "ValidatedConfig.Replica.Host", Key: "REPLICA_HOST", Rule: "required", Value: ""},
+    }
+    if len(report.Errors) != len(expected) {
+        t.Fatalf("Errors should be %v, got %v", expected, report.Errors)
+    }
+    for i := range expected {
+        if report.Errors[i] != expected[i] {
+            t.Errorf("Error should be %v, got %v", expected[i], report.Errors[i])
+        }
+    }
+
+    if strings.Contains(err.Error(), "too-short") {
+        t.Fatal("Secrets should not be part of the report")
+    }
+
+    var validationErrors validator.ValidationErrors
+    if !errors.As(err, &validationErrors) {
+        t.Fatal("Validator errors should be unwrapped")
+    }
+}
+
+type PrefixedConfig struct {
+    Database *DatabaseConfig `env:"DB" validate:"required"`
+    Cache    CacheConfig     `env:"CACHE"`
+}
+
+type CacheConfig struct {
+    Credentials *CacheCredentials `env:"CREDENTIALS" secret:"true" validate:"required"`
+}
+
+type CacheCredentials struct {
+    Password string `env:"PASSWORD"`
+}
+
+func TestConfigValidationError_Prefix(t *testing.T) {
+    t.Setenv("APP_PORT", "0")
+
+    _, err := NewConfigLoaderFromEnv[ValidatedConfig]("APP_", "", nil)
+
+    var report *ConfigValidationError
+    if !errors.As(err, &report) || report.Errors[0].Key != "APP_PORT" {
+        t.Fatalf("Key should be the env var with the prefix, got %v", err)
+    }
+}
+
+func TestConfigValidationError_NestedStruct(t *testing.T) {
+    config := &PrefixedConfig{Cache: CacheConfig{Credentials: nil}}
+    err := newConfigValidationError(config, "APP_", NewValidator().Struct(config))
+
+    var report *ConfigValidationError
+    if !errors.As(err, &report) || len(report.Errors) != 2 {
+        t.Fatalf("Nested structs should be reported, got %v", err)
+    }
+    if report.Errors[0].Key != "APP_DB" || report.Errors[1].Key != "APP_CACHE_CREDENTIALS" {
+        t.Fatalf("Keys should be built like the loader builds them, got %v", report.Errors)
+    }
+    if report.Errors[1].Value != "[REDACTED]" {
+        t.Fatalf("Secret should be redacted, got %v", report.Errors[1])
+    }
+}
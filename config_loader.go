@@ -3,23 +3,40 @@ package common
 import (
     "log"
     "os"
+    "reflect"
+    "strings"
+    "sync"
+    "sync/atomic"
 
     "github.com/go-playground/validator/v10"
-    "github.com/goccy/go-json"
     "github.com/joho/godotenv"
 )
 
 type ConfigLoader[T any] struct {
+    // Config is the config at load time, Current returns the latest one when the loader is watched
     Config   *T
     Validate *validator.Validate
+    // Sources maps the key of every loaded field to the name of the source it came from
+    Sources map[string]string
+
+    sources     []ConfigSource
+    secrets     SecretProvider
+    state       atomic.Pointer[configState[T]]
+    reloadMu    sync.Mutex
+    mu          sync.Mutex
+    subscribers []ConfigSubscriber[T]
 }
 
-// parse reads the env file and parses it into a struct
-// by splitting this function, we can also implement other loaders like NewConfigLoaderFromFlags
-func parse[T any](
-    source string,
-    validate *validator.Validate,
-) (*T, error) {
+// Source returns the name of the source the key came from, empty if no source provided it
+func (c *ConfigLoader[T]) Source(key string) string {
+    if state := c.state.Load(); state != nil {
+        return state.origins[key]
+    }
+    return c.Sources[key]
+}
+
+// readEnvFile reads the key value pairs of the env file
+func readEnvFile(source string) (map[string]string, error) {
     file, err := os.Open(source)
 
     if err != nil {
@@ -33,28 +50,94 @@ func parse[T any](
         }
     }(file)
 
-    env, err := godotenv.Parse(file)
+    return godotenv.Parse(file)
+}
+
+// parse loads the sources and parses them into a struct
+// by splitting this function, we can implement loaders for any combination of sources
+func parse[T any](
+    sources []ConfigSource,
+    secrets SecretProvider,
+    validate *validator.Validate,
+) (*T, map[string]string, error) {
+    values, origins, err := loadConfigSources[T](sources)
 
     if err != nil {
-        return nil, err
+        return nil, nil, err
     }
-    buf, err := json.Marshal(env)
 
-    if err != nil {
-        return nil, err
+    // references like file:///run/secrets/jwt are resolved, so secrets don't have to sit in the env files,
+    // only for the loaders that opted in, a value that happens to start with file:// is kept otherwise
+    if secrets != nil {
+        if err := resolveConfigSecrets[T](values, secrets); err != nil {
+            return nil, nil, err
+        }
     }
 
     var config T
 
-    if err := json.Unmarshal(buf, &config); err != nil {
-        return nil, err
+    // the values are decoded by their types, so ports, durations and lists don't have to be strings
+    if err := decodeConfig(values, &config); err != nil {
+        return nil, nil, err
     }
 
+    // the errors are reported by the env keys, the validator only knows the struct fields
     if err := validate.Struct(&config); err != nil {
+        return nil, nil, newConfigValidationError(&config, configEnvPrefix(sources), err)
+    }
+
+    return &config, origins, nil
+}
+
+// environ returns the process environment as key value pairs
+func environ() map[string]string {
+    env := make(map[string]string)
+    for _, pair := range os.Environ() {
+        if key, value, ok := strings.Cut(pair, "="); ok {
+            env[key] = value
+        }
+    }
+    return env
+}
+
+// withoutPrefix keeps the keys that start with the prefix and strips it
+func withoutPrefix(env map[string]string, prefix string) map[string]string {
+    if prefix == "" {
+        return env
+    }
+    stripped := make(map[string]string)
+    for key, value := range env {
+        if name, ok := strings.CutPrefix(key, prefix); ok && name != "" {
+            stripped[name] = value
+        }
+    }
+    return stripped
+}
+
+// newConfigLoader parses the sources into a new config loader
+func newConfigLoader[T any](
+    sources []ConfigSource,
+    secrets SecretProvider,
+    Validator *validator.Validate,
+) (*ConfigLoader[T], error) {
+    if Validator == nil {
+        Validator = NewValidator()
+    }
+
+    config, origins, err := parse[T](sources, secrets, Validator)
+    if err != nil {
         return nil, err
     }
 
-    return &config, nil
+    loader := &ConfigLoader[T]{
+        Config:   config,
+        Validate: Validator,
+        Sources:  origins,
+        sources:  sources,
+        secrets:  secrets,
+    }
+    loader.state.Store(&configState[T]{config: config, origins: origins})
+    return loader, nil
 }
 
 // NewConfigLoaderFromEnvFile creates a new config loader that reads from the env file
@@ -63,12 +146,6 @@ func NewConfigLoaderFromEnvFile[T any](
     fileName string,
     Validator *validator.Validate,
 ) (*ConfigLoader[T], error) {
-    if Validator == nil {
-        Validator = validator.New(
-            validator.WithRequiredStructEnabled(),
-        )
-    }
-
     source := ".env"
 
     if fileName != "" {
@@ -77,13 +154,73 @@ func NewConfigLoaderFromEnvFile[T any](
 
     log.Println("Loading env from ", source)
 
-    config, err := parse[T](source, Validator)
-    if err != nil {
-        return nil, err
+    sources := []ConfigSource{DefaultsSource[T]{}, &EnvFileSource{Path: source}}
+
+    return newConfigLoader[T](sources, nil, Validator)
+}
+
+// NewConfigLoaderFromEnv creates a new config loader that reads from the process environment,
+// layered over the env file if it exists, only variables with the prefix are used and the prefix is
+// stripped before they are matched with the env tags, like so: NewConfigLoaderFromEnv[Config]("APP_", ".env", nil)
+func NewConfigLoaderFromEnv[T any](
+    prefix string,
+    fileName string,
+    Validator *validator.Validate,
+) (*ConfigLoader[T], error) {
+    log.Println("Loading env with prefix", prefix)
+
+    sources := []ConfigSource{DefaultsSource[T]{}}
+    if fileName != "" {
+        sources = append(sources, &EnvFileSource{Path: fileName, Prefix: prefix, Optional: true})
     }
 
-    return &ConfigLoader[T]{
-        Config:   config,
-        Validate: Validator,
-    }, nil
+    // the process environment always wins over the file
+    return newConfigLoader[T](append(sources, &EnvSource{Prefix: prefix}), nil, Validator)
+}
+
+// NewConfigLoaderFromFlags creates a new config loader that reads from the command line flags,
+// like so: NewConfigLoaderFromFlags[Config](os.Args[1:], nil)
+func NewConfigLoaderFromFlags[T any](
+    args []string,
+    Validator *validator.Validate,
+) (*ConfigLoader[T], error) {
+    sources := []ConfigSource{DefaultsSource[T]{}, &FlagSource[T]{Args: args}}
+
+    return newConfigLoader[T](sources, nil, Validator)
+}
+
+// NewLayeredConfigLoader creates a new config loader that merges the sources, the later source wins,
+// like so: NewLayeredConfigLoader[Config](nil, DefaultConfigSources[Config]("APP_", "config.yaml", ".env", os.Args[1:])...)
+func NewLayeredConfigLoader[T any](
+    Validator *validator.Validate,
+    sources ...ConfigSource,
+) (*ConfigLoader[T], error) {
+    return newConfigLoader[T](sources, nil, Validator)
+}
+
+// NewLayeredConfigLoaderWithSecrets creates a new layered config loader that reads the file:// references
+// and resolves the secret:// references through the provider, the other loaders keep them as they are,
+// like so: NewLayeredConfigLoaderWithSecrets[Config](nil, &EnvSecretProvider{Prefix: "SECRET_"}, sources...)
+func NewLayeredConfigLoaderWithSecrets[T any](
+    Validator *validator.Validate,
+    secrets SecretProvider,
+    sources ...ConfigSource,
+) (*ConfigLoader[T], error) {
+    if secrets == nil {
+        secrets = missingSecretProvider{}
+    }
+    return newConfigLoader[T](sources, secrets, Validator)
+}
+
+// String prints the current config with the secret fields redacted, one KEY=value per line
+func (c *ConfigLoader[T]) String() string {
+    values := RedactConfig(c.Current())
+
+    var builder strings.Builder
+    for _, field := range configFields(reflect.TypeFor[T]()) {
+        if value, ok := values[field.Key]; ok {
+            builder.WriteString(field.Key + "=" + value + "\n")
+        }
+    }
+    return builder.String()
 }
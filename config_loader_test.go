@@ -1,6 +1,8 @@
 package common
 
 import (
+    "os"
+    "path/filepath"
     "testing"
 )
 
@@ -28,3 +30,56 @@ func TestNewConfigLoaderFromEnvFile_MustFail(t *testing.T) {
     }
 
 }
+
+type EnvConfig struct {
+    Port        string `env:"PORT" validate:"required"`
+    DatabaseURL string `env:"DATABASE_URL" validate:"required"`
+}
+
+func writeTestEnvFile(t *testing.T, content string) string {
+    fileName := filepath.Join(t.TempDir(), ".env")
+    if err := os.WriteFile(fileName, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return fileName
+}
+
+func TestNewConfigLoaderFromEnv(t *testing.T) {
+    fileName := writeTestEnvFile(t, "APP_PORT=8080\nAPP_DATABASE_URL=postgres://file\n")
+    t.Setenv("APP_DATABASE_URL", "postgres://env")
+
+    config, err := NewConfigLoaderFromEnv[EnvConfig]("APP_", fileName, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.Config.Port != "8080" {
+        t.Fatal("Port should be read from the env file")
+    }
+    if config.Config.DatabaseURL != "postgres://env" {
+        t.Fatal("Database url from the environment should win over the env file")
+    }
+}
+
+func TestNewConfigLoaderFromEnv_WithoutFile(t *testing.T) {
+    t.Setenv("APP_PORT", "8080")
+    t.Setenv("APP_DATABASE_URL", "postgres://env")
+
+    config, err := NewConfigLoaderFromEnv[EnvConfig]("APP_", filepath.Join(t.TempDir(), ".env"), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.Config.Port != "8080" {
+        t.Fatal("Port should be 8080")
+    }
+}
+
+func TestNewConfigLoaderFromEnv_MustFail(t *testing.T) {
+    // variables without the prefix must not be used
+    t.Setenv("PORT", "8080")
+    t.Setenv("DATABASE_URL", "postgres://env")
+
+    _, err := NewConfigLoaderFromEnv[EnvConfig]("APP_", "", nil)
+    if err == nil {
+        t.Fatal("Config loader should fail")
+    }
+}
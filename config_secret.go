@@ -0,0 +1,262 @@
+package common
+
+import (
+    "context"
+    "encoding"
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "time"
+
+    "github.com/goccy/go-json"
+)
+
+var (
+    ErrSecretNotFound    = errors.New("secret not found")
+    ErrInvalidSecretName = errors.New("invalid secret name")
+    ErrNoSecretProvider  = errors.New("no secret provider configured")
+)
+
+// DefaultSecretProvider reads the secrets docker and kubernetes mount, the references are only resolved
+// by loaders that opt in, like so: NewLayeredConfigLoaderWithSecrets[Config](nil, DefaultSecretProvider, sources...)
+var DefaultSecretProvider SecretProvider = &FileSecretProvider{Dir: "/run/secrets"}
+
+const (
+    // FileSecretScheme references a file that holds the value, like so: file:///run/secrets/jwt
+    FileSecretScheme = "file://"
+    // SecretScheme references a secret of the SecretProvider, like so: secret://jwt
+    SecretScheme = "secret://"
+
+    redactedConfigValue = "[REDACTED]"
+)
+
+// SecretProvider resolves the secret references of the config, like so: secret://jwt
+type SecretProvider interface {
+    Secret(ctx context.Context, name string) (string, error)
+}
+
+// missingSecretProvider fails the secret:// references of a loader that opted in without a provider,
+// the file:// references are still read
+type missingSecretProvider struct{}
+
+// Secret implements SecretProvider
+func (missingSecretProvider) Secret(context.Context, string) (string, error) {
+    return "", ErrNoSecretProvider
+}
+
+// FileSecretProvider reads the secrets from the files of the directory,
+// like the secrets docker and kubernetes mount under /run/secrets
+type FileSecretProvider struct {
+    Dir string
+}
+
+// Secret implements SecretProvider
+func (p *FileSecretProvider) Secret(_ context.Context, name string) (string, error) {
+    // the name must not escape the directory
+    if name == "" || !filepath.IsLocal(name) {
+        return "", fmt.Errorf("%w: %s", ErrInvalidSecretName, name)
+    }
+    return readSecretFile(filepath.Join(p.Dir, name))
+}
+
+// EnvSecretProvider reads the secrets from the environment variables with the prefix,
+// like so: secret://jwt is SECRET_JWT with the prefix SECRET_
+type EnvSecretProvider struct {
+    Prefix string
+}
+
+// Secret implements SecretProvider
+func (p *EnvSecretProvider) Secret(_ context.Context, name string) (string, error) {
+    key := p.Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", "/", "_").Replace(name))
+    value, ok := os.LookupEnv(key)
+    if !ok {
+        return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+    }
+    return value, nil
+}
+
+// readSecretFile reads the secret without the trailing newline most editors and tools add
+func readSecretFile(path string) (string, error) {
+    buf, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return "", fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+    }
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(string(buf), "\r\n"), nil
+}
+
+// resolveSecret resolves the value if it is a secret reference, other values are returned as is
+func resolveSecret(ctx context.Context, secrets SecretProvider, value string) (string, error) {
+    if path, ok := strings.CutPrefix(value, FileSecretScheme); ok {
+        return readSecretFile(path)
+    }
+    if name, ok := strings.CutPrefix(value, SecretScheme); ok {
+        return secrets.Secret(ctx, name)
+    }
+    return value, nil
+}
+
+// resolveConfigSecrets resolves the secret references of the values of the config fields,
+// the other values, like unrelated environment variables, are left untouched
+func resolveConfigSecrets[T any](values map[string]string, secrets SecretProvider) error {
+    ctx := context.Background()
+    for _, field := range configFields(reflect.TypeFor[T]()) {
+        key := strings.ToUpper(field.Key)
+        value, ok := values[key]
+        if !ok {
+            continue
+        }
+        resolved, err := resolveSecret(ctx, secrets, value)
+        if err != nil {
+            return fmt.Errorf("%s: %w", field.Key, err)
+        }
+        values[key] = resolved
+    }
+    return nil
+}
+
+// Redacted holds a secret that is never printed, logged or encoded, unlike the secret tag it also
+// protects the value when the config struct itself is printed, like so: fmt.Printf("%+v", config),
+// the value is read with Value, like so: JwtSecret Redacted[string] `env:"JWT_SECRET" validate:"required"`
+type Redacted[T any] struct {
+    value T
+}
+
+// NewRedacted wraps the secret value
+func NewRedacted[T any](value T) Redacted[T] {
+    return Redacted[T]{value: value}
+}
+
+// Value returns the secret value
+func (r Redacted[T]) Value() T {
+    return r.value
+}
+
+// String implements fmt.Stringer
+func (r Redacted[T]) String() string {
+    return redactedConfigValue
+}
+
+// GoString implements fmt.GoStringer, so %#v is redacted too
+func (r Redacted[T]) GoString() string {
+    return redactedConfigValue
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (r Redacted[T]) MarshalText() ([]byte, error) {
+    return []byte(redactedConfigValue), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (r Redacted[T]) MarshalJSON() ([]byte, error) {
+    return json.Marshal(redactedConfigValue)
+}
+
+// UnmarshalText decodes the value like decodeConfig decodes a field of the type
+func (r *Redacted[T]) UnmarshalText(text []byte) error {
+    return decodeConfigValue(reflect.ValueOf(&r.value).Elem(), string(text), defaultConfigSeparator)
+}
+
+// secretValue unwraps the value for the validator, see NewValidator
+func (r Redacted[T]) secretValue() any {
+    return r.value
+}
+
+// redactedSecret is implemented by every Redacted type
+type redactedSecret interface {
+    secretValue() any
+}
+
+var redactedSecretType = reflect.TypeOf((*redactedSecret)(nil)).Elem()
+
+// isSecretField checks the secret tag of the field, like so: `env:"JWT_SECRET" secret:"true"`,
+// Redacted fields are always secret
+func isSecretField(field reflect.StructField) bool {
+    return field.Tag.Get("secret") == "true" || field.Type.Implements(redactedSecretType)
+}
+
+// RedactConfig returns the values of the config keyed like the env keys,
+// the values of the secret fields are redacted so the config can be logged
+func RedactConfig(config any) map[string]string {
+    v := reflect.ValueOf(config)
+    for v.Kind() == reflect.Pointer {
+        if v.IsNil() {
+            return nil
+        }
+        v = v.Elem()
+    }
+    if v.Kind() != reflect.Struct {
+        return nil
+    }
+
+    values := make(map[string]string)
+    for _, field := range configFields(v.Type()) {
+        fieldValue, ok := configFieldValue(v, field)
+        if !ok {
+            continue
+        }
+        values[field.Key] = formatConfigField(field, fieldValue)
+    }
+    return values
+}
+
+// formatConfigField formats the value of the field like it is written in the env, redacted if it is a secret
+func formatConfigField(field configField, v reflect.Value) string {
+    formatted := formatConfigFieldValue(v, field.Field.Tag.Get("envSeparator"))
+    if isSecretField(field.Field) && formatted != "" {
+        return redactedConfigValue
+    }
+    return formatted
+}
+
+func formatConfigFieldValue(v reflect.Value, separator string) string {
+    if separator == "" {
+        separator = defaultConfigSeparator
+    }
+    if v.Kind() == reflect.Pointer {
+        if v.IsNil() {
+            return ""
+        }
+        v = v.Elem()
+    }
+
+    if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+        text, err := marshaler.MarshalText()
+        if err != nil {
+            return ""
+        }
+        return string(text)
+    }
+    if v.CanAddr() {
+        if marshaler, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+            text, err := marshaler.MarshalText()
+            if err != nil {
+                return ""
+            }
+            return string(text)
+        }
+    }
+
+    switch {
+    case v.Type() == durationType:
+        return time.Duration(v.Int()).String()
+    case v.Type() == urlType:
+        u := v.Interface().(url.URL)
+        return u.String()
+    case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+        return string(v.Bytes())
+    case v.Kind() == reflect.Slice:
+        parts := make([]string, v.Len())
+        for i := range parts {
+            parts[i] = formatConfigFieldValue(v.Index(i), separator)
+        }
+        return strings.Join(parts, separator)
+    }
+    return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/goccy/go-json"
+)
+
+type SecretConfig struct {
+    JwtSecret      string         `env:"JWT_SECRET" secret:"true" validate:"required"`
+    RabbitPassword string         `env:"RABBIT_PASSWORD" secret:"true"`
+    RabbitUser     string         `env:"RABBIT_USER"`
+    Database       DatabaseConfig `env:"DB"`
+}
+
+func TestNewLayeredConfigLoaderWithSecrets(t *testing.T) {
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "jwt"), []byte("jwt-from-file\n"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    envFile := writeTestConfigFile(
+        t, ".env",
+        "JWT_SECRET=file://"+filepath.Join(dir, "jwt")+"\nRABBIT_PASSWORD=secret://rabbit-password\nRABBIT_USER=guest\n",
+    )
+    t.Setenv("SECRET_RABBIT_PASSWORD", "rabbit-from-env")
+
+    config, err := NewLayeredConfigLoaderWithSecrets[SecretConfig](
+        nil, &EnvSecretProvider{Prefix: "SECRET_"}, &EnvFileSource{Path: envFile},
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.Config.JwtSecret != "jwt-from-file" {
+        t.Fatalf("Jwt secret should be read from the file, got %q", config.Config.JwtSecret)
+    }
+    if config.Config.RabbitPassword != "rabbit-from-env" {
+        t.Fatalf("Rabbit password should be read from the provider, got %q", config.Config.RabbitPassword)
+    }
+
+    printed := fmt.Sprint(config)
+    if strings.Contains(printed, "jwt-from-file") || strings.Contains(printed, "rabbit-from-env") {
+        t.Fatalf("Secrets should be redacted, got %s", printed)
+    }
+    if !strings.Contains(printed, "RABBIT_USER=guest\n") || !strings.Contains(printed, "JWT_SECRET=[REDACTED]\n") {
+        t.Fatalf("Config should be printed, got %s", printed)
+    }
+}
+
+func TestNewLayeredConfigLoaderWithSecrets_MustFail(t *testing.T) {
+    envFile := writeTestConfigFile(t, ".env", "JWT_SECRET=secret://jwt\n")
+
+    _, err := NewLayeredConfigLoaderWithSecrets[SecretConfig](
+        nil, &EnvSecretProvider{Prefix: "SECRET_"}, &EnvFileSource{Path: envFile},
+    )
+    if !errors.Is(err, ErrSecretNotFound) {
+        t.Fatalf("Missing secrets should fail, got %v", err)
+    }
+
+    _, err = NewLayeredConfigLoaderWithSecrets[SecretConfig](nil, nil, &EnvFileSource{Path: envFile})
+    if !errors.Is(err, ErrNoSecretProvider) {
+        t.Fatalf("Secret references without a provider should fail, got %v", err)
+    }
+}
+
+func TestFileSecretProvider_MustFail(t *testing.T) {
+    provider := &FileSecretProvider{Dir: t.TempDir()}
+    for _, name := range []string{"", "../jwt", "/etc/passwd"} {
+        if _, err := provider.Secret(context.Background(), name); !errors.Is(err, ErrInvalidSecretName) {
+            t.Fatalf("Secret name %q should be rejected, got %v", name, err)
+        }
+    }
+}
+
+func TestRedactConfig(t *testing.T) {
+    values := RedactConfig(
+        &TypedConfig{
+            Port:    8080,
+            Origins: []string{"a", "b"},
+            Ports:   []int{80, 443},
+        },
+    )
+    if values["PORT"] != "8080" || values["ORIGINS"] != "a,b" || values["PORTS"] != "80;443" {
+        t.Fatalf("Values should be formatted like the env, got %v", values)
+    }
+
+    values = RedactConfig(SecretConfig{RabbitUser: "guest", JwtSecret: "jwt"})
+    if values["JWT_SECRET"] != "[REDACTED]" || values["RABBIT_PASSWORD"] != "" || values["RABBIT_USER"] != "guest" {
+        t.Fatalf("Secrets should be redacted, got %v", values)
+    }
+}
+
+func TestNewConfigLoader_SecretsOptIn(t *testing.T) {
+    envFile := writeTestConfigFile(t, ".env", "JWT_SECRET=file:///run/secrets/jwt\n")
+
+    config, err := NewLayeredConfigLoader[SecretConfig](nil, &EnvFileSource{Path: envFile})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.Config.JwtSecret != "file:///run/secrets/jwt" {
+        t.Fatalf("References should only be resolved by loaders that opt in, got %q", config.Config.JwtSecret)
+    }
+}
+
+type RedactedConfig struct {
+    JwtSecret Redacted[string] `env:"JWT_SECRET" json:"jwt_secret" validate:"required,min=8"`
+    Port      int              `env:"PORT" json:"port"`
+}
+
+func TestRedacted(t *testing.T) {
+    envFile := writeTestConfigFile(t, ".env", "JWT_SECRET=jwt-from-env\nPORT=8080\n")
+
+    config, err := NewLayeredConfigLoader[RedactedConfig](nil, &EnvFileSource{Path: envFile})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.Config.JwtSecret.Value() != "jwt-from-env" {
+        t.Fatalf("Secret should be decoded, got %q", config.Config.JwtSecret.Value())
+    }
+
+    encoded, err := json.Marshal(config.Config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, printed := range []string{
+        fmt.Sprintf("%v", *config.Config),
+        fmt.Sprintf("%+v", config.Config),
+        fmt.Sprintf("%#v", *config.Config),
+        string(encoded),
+        config.String(),
+    } {
+        if strings.Contains(printed, "jwt-from-env") || !strings.Contains(printed, "[REDACTED]") {
+            t.Fatalf("Secret should be redacted, got %s", printed)
+        }
+    }
+}
+
+func TestRedacted_MustFail(t *testing.T) {
+    envFile := writeTestConfigFile(t, ".env", "JWT_SECRET=short\n")
+
+    _, err := NewLayeredConfigLoader[RedactedConfig](nil, &EnvFileSource{Path: envFile})
+
+    var validationErr *ConfigValidationError
+    if !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 {
+        t.Fatalf("Secret should be validated by its value, got %v", err)
+    }
+    if strings.Contains(err.Error(), "short") {
+        t.Fatalf("Secret should be redacted in the error, got %v", err)
+    }
+}
@@ -0,0 +1,305 @@
+package common
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/BurntSushi/toml"
+    "github.com/goccy/go-json"
+    "gopkg.in/yaml.v3"
+)
+
+var (
+    ErrUnsupportedConfigFile = errors.New("unsupported config file format")
+)
+
+// ConfigSource provides raw config values keyed like the env keys of the config, like DB_HOST
+type ConfigSource interface {
+    // Name describes the source, it is reported as the origin of the values it provides
+    Name() string
+    Load() (map[string]string, error)
+}
+
+// DefaultsSource provides the values of the default tags, like so: `env:"PORT" default:"8080"`
+type DefaultsSource[T any] struct{}
+
+// Name implements ConfigSource
+func (DefaultsSource[T]) Name() string {
+    return "default"
+}
+
+// Load implements ConfigSource
+func (DefaultsSource[T]) Load() (map[string]string, error) {
+    values := make(map[string]string)
+    for _, field := range configFields(reflect.TypeFor[T]()) {
+        if value, ok := field.Field.Tag.Lookup("default"); ok {
+            values[field.Key] = value
+        }
+    }
+    return values, nil
+}
+
+// FileSource provides the values of a json, yaml or toml file, picked by the extension,
+// nested objects are joined with "_" and arrays with ",", like so: db: {host: localhost} is DB_HOST
+type FileSource struct {
+    Path string
+    // Optional skips the file if it doesn't exist
+    Optional bool
+}
+
+// Name implements ConfigSource
+func (s *FileSource) Name() string {
+    return "file:" + s.Path
+}
+
+// Load implements ConfigSource
+func (s *FileSource) Load() (map[string]string, error) {
+    buf, err := os.ReadFile(s.Path)
+    if s.Optional && errors.Is(err, os.ErrNotExist) {
+        log.Println("Skipping missing config file", s.Path)
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    content := make(map[string]any)
+    switch strings.ToLower(filepath.Ext(s.Path)) {
+    case ".json":
+        decoder := json.NewDecoder(strings.NewReader(string(buf)))
+        // large integers would be formatted as floats otherwise
+        decoder.UseNumber()
+        err = decoder.Decode(&content)
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(buf, &content)
+    case ".toml":
+        err = toml.Unmarshal(buf, &content)
+    default:
+        return nil, fmt.Errorf("%w: %s", ErrUnsupportedConfigFile, s.Path)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    values := make(map[string]string)
+    flattenConfig("", content, values)
+    return values, nil
+}
+
+// flattenConfig flattens the nested objects of a config file into env keys
+func flattenConfig(prefix string, value any, values map[string]string) {
+    switch v := value.(type) {
+    case map[string]any:
+        for key, nested := range v {
+            key = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+            if prefix != "" {
+                key = prefix + "_" + key
+            }
+            flattenConfig(key, nested, values)
+        }
+    case []any:
+        parts := make([]string, 0, len(v))
+        for _, item := range v {
+            parts = append(parts, formatConfigValue(item))
+        }
+        values[prefix] = strings.Join(parts, defaultConfigSeparator)
+    default:
+        values[prefix] = formatConfigValue(v)
+    }
+}
+
+// formatConfigValue formats a scalar of a config file the way decodeConfig parses it
+func formatConfigValue(value any) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case string:
+        return v
+    case float64:
+        return strconv.FormatFloat(v, 'f', -1, 64)
+    case time.Time:
+        return v.Format(time.RFC3339Nano)
+    }
+    return fmt.Sprint(value)
+}
+
+// EnvFileSource provides the values of a .env file,
+// only keys with the prefix are used and the prefix is stripped
+type EnvFileSource struct {
+    Path   string
+    Prefix string
+    // Optional skips the file if it doesn't exist
+    Optional bool
+}
+
+// Name implements ConfigSource
+func (s *EnvFileSource) Name() string {
+    return "envfile:" + s.Path
+}
+
+// Load implements ConfigSource
+func (s *EnvFileSource) Load() (map[string]string, error) {
+    env, err := readEnvFile(s.Path)
+    // in containers the config usually comes from the environment only
+    if s.Optional && errors.Is(err, os.ErrNotExist) {
+        log.Println("Skipping missing env file", s.Path)
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return withoutPrefix(env, s.Prefix), nil
+}
+
+// EnvSource provides the process environment,
+// only variables with the prefix are used and the prefix is stripped
+type EnvSource struct {
+    Prefix string
+}
+
+// Name implements ConfigSource
+func (s *EnvSource) Name() string {
+    return "env"
+}
+
+// Load implements ConfigSource
+func (s *EnvSource) Load() (map[string]string, error) {
+    return withoutPrefix(environ(), s.Prefix), nil
+}
+
+// FlagSource provides the command line flags that were set, every field of the config
+// has a flag named after its key or the flag tag, like so: DB_HOST is -db-host
+type FlagSource[T any] struct {
+    // Args are the arguments without the program name, like os.Args[1:]
+    Args []string
+}
+
+// Name implements ConfigSource
+func (s *FlagSource[T]) Name() string {
+    return "flag"
+}
+
+// configFlagName returns the flag of the field, from the flag tag or the key in kebab case
+func configFlagName(field configField) string {
+    if name, ok := field.Field.Tag.Lookup("flag"); ok {
+        return name
+    }
+    return strings.ReplaceAll(strings.ToLower(field.Key), "_", "-")
+}
+
+// boolFlag is the flag of a bool field, so -debug works without a value,
+// the value is kept as a string and parsed by decodeConfig like the other sources
+type boolFlag struct {
+    value string
+}
+
+func (b *boolFlag) String() string {
+    return b.value
+}
+
+func (b *boolFlag) Set(value string) error {
+    b.value = value
+    return nil
+}
+
+func (b *boolFlag) IsBoolFlag() bool {
+    return true
+}
+
+// isBoolConfig checks if the field is a bool or a pointer to one
+func isBoolConfig(t reflect.Type) bool {
+    if t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    return t.Kind() == reflect.Bool
+}
+
+// Load implements ConfigSource
+func (s *FlagSource[T]) Load() (map[string]string, error) {
+    flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+    // the error is returned to the caller, a library shouldn't print the usage
+    flags.SetOutput(io.Discard)
+
+    keys := make(map[string]string)
+    for _, field := range configFields(reflect.TypeFor[T]()) {
+        name := configFlagName(field)
+        if name == "-" {
+            continue
+        }
+        keys[name] = field.Key
+        if isBoolConfig(field.Field.Type) {
+            flags.Var(&boolFlag{value: field.Field.Tag.Get("default")}, name, field.Field.Tag.Get("usage"))
+            continue
+        }
+        flags.String(name, field.Field.Tag.Get("default"), field.Field.Tag.Get("usage"))
+    }
+
+    if err := flags.Parse(s.Args); err != nil {
+        return nil, err
+    }
+
+    // only the flags that were set override the other sources
+    values := make(map[string]string)
+    flags.Visit(
+        func(f *flag.Flag) {
+            values[keys[f.Name]] = f.Value.String()
+        },
+    )
+    return values, nil
+}
+
+// DefaultConfigSources returns the sources in the order of their precedence, the later wins:
+// defaults, the config file, the .env file, the environment and the flags,
+// the files are optional and skipped if their name is empty
+func DefaultConfigSources[T any](prefix, configFile, envFile string, args []string) []ConfigSource {
+    sources := []ConfigSource{DefaultsSource[T]{}}
+    if configFile != "" {
+        sources = append(sources, &FileSource{Path: configFile, Optional: true})
+    }
+    if envFile != "" {
+        sources = append(sources, &EnvFileSource{Path: envFile, Prefix: prefix, Optional: true})
+    }
+    return append(sources, &EnvSource{Prefix: prefix}, &FlagSource[T]{Args: args})
+}
+
+// loadConfigSources merges the values of the sources, the later source wins,
+// and reports which source each field of the config came from
+func loadConfigSources[T any](sources []ConfigSource) (map[string]string, map[string]string, error) {
+    t := reflect.TypeFor[T]()
+    if t.Kind() != reflect.Struct {
+        return nil, nil, ErrInvalidConfigTarget
+    }
+
+    // keys are matched case-insensitively, so they are merged by their upper case
+    values := make(map[string]string)
+    origins := make(map[string]string)
+    for _, source := range sources {
+        sourceValues, err := source.Load()
+        if err != nil {
+            return nil, nil, fmt.Errorf("%s: %w", source.Name(), err)
+        }
+        for key, value := range sourceValues {
+            key = strings.ToUpper(key)
+            values[key] = value
+            origins[key] = source.Name()
+        }
+    }
+
+    reported := make(map[string]string)
+    for _, field := range configFields(t) {
+        if origin, ok := origins[strings.ToUpper(field.Key)]; ok {
+            reported[field.Key] = origin
+        }
+    }
+
+    return values, reported, nil
+}
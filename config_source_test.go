@@ -0,0 +1,132 @@
+package common
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+type LayeredConfig struct {
+    Port     int            `env:"PORT" default:"8080" usage:"port to listen on"`
+    Debug    bool           `env:"DEBUG" flag:"verbose"`
+    Timeout  time.Duration  `env:"TIMEOUT" default:"5s"`
+    Origins  []string       `env:"ORIGINS"`
+    Database DatabaseConfig `env:"DB"`
+}
+
+func writeTestConfigFile(t *testing.T, name, content string) string {
+    fileName := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(fileName, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return fileName
+}
+
+func TestFileSource(t *testing.T) {
+    files := map[string]string{
+        "config.json": `{"port": 9000, "origins": ["a", "b"], "db": {"host": "db", "max-conns": 20}}`,
+        "config.yaml": "port: 9000\norigins: [a, b]\ndb:\n  host: db\n  max-conns: 20\n",
+        "config.toml": "port = 9000\norigins = [\"a\", \"b\"]\n[db]\nhost = \"db\"\nmax-conns = 20\n",
+    }
+    expected := map[string]string{
+        "PORT":         "9000",
+        "ORIGINS":      "a,b",
+        "DB_HOST":      "db",
+        "DB_MAX_CONNS": "20",
+    }
+
+    for name, content := range files {
+        t.Run(
+            name, func(t *testing.T) {
+                source := &FileSource{Path: writeTestConfigFile(t, name, content)}
+                values, err := source.Load()
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if !reflect.DeepEqual(values, expected) {
+                    t.Fatalf("Values should be %v, got %v", expected, values)
+                }
+            },
+        )
+    }
+}
+
+func TestFileSource_MustFail(t *testing.T) {
+    source := &FileSource{Path: writeTestConfigFile(t, "config.ini", "port=9000")}
+    if _, err := source.Load(); !errors.Is(err, ErrUnsupportedConfigFile) {
+        t.Fatalf("Unsupported files should fail, got %v", err)
+    }
+
+    source = &FileSource{Path: filepath.Join(t.TempDir(), "config.yaml")}
+    if _, err := source.Load(); err == nil {
+        t.Fatal("Missing files should fail unless optional")
+    }
+
+    source.Optional = true
+    if _, err := source.Load(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestNewLayeredConfigLoader(t *testing.T) {
+    configFile := writeTestConfigFile(t, "config.yaml", "port: 9000\ndebug: false\ndb:\n  host: file\n  port: 5432\n")
+    envFile := writeTestConfigFile(t, ".env", "APP_DB_HOST=envfile\nAPP_ORIGINS=a,b\n")
+    t.Setenv("APP_DB_PORT", "6432")
+
+    config, err := NewLayeredConfigLoader[LayeredConfig](
+        nil, DefaultConfigSources[LayeredConfig]("APP_", configFile, envFile, []string{"-verbose", "true"})...,
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := LayeredConfig{
+        Port:     9000,
+        Debug:    true,
+        Timeout:  5 * time.Second,
+        Origins:  []string{"a", "b"},
+        Database: DatabaseConfig{Host: "envfile", Port: 6432},
+    }
+    if !reflect.DeepEqual(*config.Config, expected) {
+        t.Fatalf("Config should be %+v, got %+v", expected, *config.Config)
+    }
+
+    sources := map[string]string{
+        "PORT":    "file:" + configFile,
+        "DEBUG":   "flag",
+        "TIMEOUT": "default",
+        "ORIGINS": "envfile:" + envFile,
+        "DB_HOST": "envfile:" + envFile,
+        "DB_PORT": "env",
+    }
+    for key, source := range sources {
+        if config.Source(key) != source {
+            t.Errorf("Source of %s should be %s, got %s", key, source, config.Source(key))
+        }
+    }
+    if config.Source("DB_MAX_CONNS") != "" {
+        t.Error("Fields without a value should have no source")
+    }
+}
+
+func TestNewConfigLoaderFromFlags(t *testing.T) {
+    config, err := NewConfigLoaderFromFlags[LayeredConfig](
+        []string{"-verbose", "-port", "9000", "-db-host", "db", "-origins", "a,b"}, nil,
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !config.Config.Debug || config.Config.Port != 9000 || config.Config.Database.Host != "db" {
+        t.Fatalf("Flags should be decoded, got %+v", *config.Config)
+    }
+    if config.Config.Timeout != 5*time.Second {
+        t.Fatal("Defaults should be used for flags that are not set")
+    }
+
+    if _, err := NewConfigLoaderFromFlags[LayeredConfig]([]string{"-unknown", "value"}, nil); err == nil {
+        t.Fatal("Unknown flags should fail")
+    }
+}
@@ -0,0 +1,131 @@
+package common
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "slices"
+    "strings"
+    "time"
+)
+
+const defaultConfigWatchInterval = 2 * time.Second
+
+// ConfigSubscriber is notified with the old and next config after every successful reload
+type ConfigSubscriber[T any] func(old, next *T)
+
+// WatchedSource is a source backed by files, Watch reloads the config when they change
+type WatchedSource interface {
+    ConfigSource
+    Files() []string
+}
+
+// Files implements WatchedSource
+func (s *FileSource) Files() []string {
+    return []string{s.Path}
+}
+
+// Files implements WatchedSource
+func (s *EnvFileSource) Files() []string {
+    return []string{s.Path}
+}
+
+// configState is the config and the sources of its values, swapped together on reload
+type configState[T any] struct {
+    config  *T
+    origins map[string]string
+}
+
+// Current returns the latest valid config, use it instead of Config when the loader is watched
+func (c *ConfigLoader[T]) Current() *T {
+    if state := c.state.Load(); state != nil {
+        return state.config
+    }
+    return c.Config
+}
+
+// Subscribe registers a subscriber that is notified after every successful reload
+func (c *ConfigLoader[T]) Subscribe(subscriber ConfigSubscriber[T]) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.subscribers = append(c.subscribers, subscriber)
+}
+
+// Reload parses and validates the sources again and swaps the config,
+// an invalid config is rejected and the previous one is kept
+func (c *ConfigLoader[T]) Reload() error {
+    // the reloads are serialized from the parse to the swap, so an older parse never replaces a newer one
+    c.reloadMu.Lock()
+    config, origins, err := parse[T](c.sources, c.secrets, c.Validate)
+    if err != nil {
+        c.reloadMu.Unlock()
+        log.Println("Rejected config reload", err)
+        return err
+    }
+
+    old := c.Current()
+    c.state.Store(&configState[T]{config: config, origins: origins})
+    c.mu.Lock()
+    subscribers := slices.Clone(c.subscribers)
+    c.mu.Unlock()
+    c.reloadMu.Unlock()
+    log.Println("Reloaded config")
+
+    // the subscribers are called without the locks, so they may subscribe, reload or use the loader
+    for _, subscriber := range subscribers {
+        subscriber(old, config)
+    }
+    return nil
+}
+
+// Watch polls the files of the sources and reloads the config when they change,
+// until the context is done, like so: go loader.Watch(ctx, 5*time.Second)
+func (c *ConfigLoader[T]) Watch(ctx context.Context, interval time.Duration) error {
+    if interval <= 0 {
+        interval = defaultConfigWatchInterval
+    }
+
+    var files []string
+    for _, source := range c.sources {
+        if watched, ok := source.(WatchedSource); ok {
+            files = append(files, watched.Files()...)
+        }
+    }
+
+    // polling works on every platform and with the symlinks mounted config maps are swapped with
+    snapshot := statConfigFiles(files)
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+            current := statConfigFiles(files)
+            if current == snapshot {
+                continue
+            }
+            snapshot = current
+            // the error is logged by Reload and the previous config is kept
+            _ = c.Reload()
+        }
+    }
+}
+
+// statConfigFiles fingerprints the files by their modification time and size,
+// a missing file is part of the fingerprint too
+func statConfigFiles(files []string) string {
+    var fingerprint strings.Builder
+    for _, file := range files {
+        info, err := os.Stat(file)
+        if err != nil {
+            fmt.Fprintf(&fingerprint, "%s:missing;", file)
+            continue
+        }
+        fmt.Fprintf(&fingerprint, "%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+    }
+    return fingerprint.String()
+}
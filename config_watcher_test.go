@@ -0,0 +1,133 @@
+package common
+
+import (
+    "context"
+    "os"
+    "testing"
+    "time"
+)
+
+type ReloadConfig struct {
+    LogLevel string   `env:"LOG_LEVEL" validate:"oneof=debug info warn error"`
+    Origins  []string `env:"ORIGINS"`
+}
+
+func rewriteTestConfigFile(t *testing.T, fileName, content string) {
+    if err := os.WriteFile(fileName, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    // the modification time may not change within the resolution of the file system
+    modified := time.Now().Add(time.Second)
+    if err := os.Chtimes(fileName, modified, modified); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestConfigLoader_Watch(t *testing.T) {
+    fileName := writeTestConfigFile(t, "config.yaml", "log_level: info\norigins: [a]\n")
+    loader, err := NewLayeredConfigLoader[ReloadConfig](nil, &FileSource{Path: fileName})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    reloads := make(chan [2]*ReloadConfig, 1)
+    loader.Subscribe(
+        func(old, next *ReloadConfig) {
+            // only the first reload is checked, the later ones are dropped
+            select {
+            case reloads <- [2]*ReloadConfig{old, next}:
+            default:
+            }
+        },
+    )
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go loader.Watch(ctx, 10*time.Millisecond)
+
+    // the watcher may not have its first snapshot yet, so the file is rewritten until it is reloaded
+    rewrite := time.NewTicker(20 * time.Millisecond)
+    defer rewrite.Stop()
+    timeout := time.After(time.Second)
+
+    var reload [2]*ReloadConfig
+    for reload[0] == nil {
+        select {
+        case reload = <-reloads:
+        case <-rewrite.C:
+            rewriteTestConfigFile(t, fileName, "log_level: debug\norigins: [a, b]\n")
+        case <-timeout:
+            t.Fatal("Config should be reloaded")
+        }
+    }
+    if reload[0].LogLevel != "info" || reload[1].LogLevel != "debug" {
+        t.Fatalf("Subscriber should get the old and next config, got %+v and %+v", reload[0], reload[1])
+    }
+
+    if loader.Current().LogLevel != "debug" || len(loader.Current().Origins) != 2 {
+        t.Fatalf("Current config should be swapped, got %+v", loader.Current())
+    }
+    if loader.Config.LogLevel != "info" {
+        t.Fatal("Config at load time should not change")
+    }
+}
+
+func TestConfigLoader_Reload_MustFail(t *testing.T) {
+    fileName := writeTestConfigFile(t, "config.yaml", "log_level: info\n")
+    loader, err := NewLayeredConfigLoader[ReloadConfig](nil, &FileSource{Path: fileName})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    notified := false
+    loader.Subscribe(
+        func(old, next *ReloadConfig) {
+            notified = true
+        },
+    )
+
+    rewriteTestConfigFile(t, fileName, "log_level: verbose\n")
+    if err := loader.Reload(); err == nil {
+        t.Fatal("Invalid config should be rejected")
+    }
+    if loader.Current().LogLevel != "info" {
+        t.Fatal("Previous config should be kept")
+    }
+    if notified {
+        t.Fatal("Subscribers should not be notified of rejected reloads")
+    }
+}
+
+func TestConfigLoader_Reload_Subscriber(t *testing.T) {
+    fileName := writeTestConfigFile(t, "config.yaml", "log_level: info\n")
+    loader, err := NewLayeredConfigLoader[ReloadConfig](nil, &FileSource{Path: fileName})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // a subscriber that uses the loader must not deadlock the reload
+    subscribed := false
+    loader.Subscribe(
+        func(old, next *ReloadConfig) {
+            if loader.Current() != next {
+                t.Error("Current config should be swapped before the subscribers are notified")
+            }
+            loader.Subscribe(
+                func(old, next *ReloadConfig) {
+                    subscribed = true
+                },
+            )
+        },
+    )
+
+    rewriteTestConfigFile(t, fileName, "log_level: debug\n")
+    if err := loader.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    if err := loader.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    if !subscribed {
+        t.Fatal("Subscriber added during a reload should be notified of the next one")
+    }
+}
@@ -1,10 +1,26 @@
 package common
 
 const (
-    XSignature      = "X-Signature"
-    ContentType     = "Content-Type"
-    ApplicationJSON = "application/json"
-    Body            = "body"
-    Authorization   = "Authorization"
-    UserContextKey  = "user"
+    XSignature          = "X-Signature"
+    XSignatureVersion   = "X-Signature-Version"
+    XSignatureTimestamp = "X-Signature-Timestamp"
+    XSignatureNonce     = "X-Signature-Nonce"
+    XSignatureHeaders   = "X-Signature-Headers"
+    XSignatureKeyID     = "X-Signature-Key-Id"
+    XContentSHA256      = "X-Content-SHA256"
+    XTenantID           = "X-Tenant-ID"
+    XAPIKey             = "X-API-Key"
+    XWebhookEventID     = "X-Webhook-Event-Id"
+    XWebhookEventType   = "X-Webhook-Event-Type"
+    XTotalCount         = "X-Total-Count"
+    ContentType         = "Content-Type"
+    ApplicationJSON     = "application/json"
+    Body                = "body"
+    Authorization       = "Authorization"
+    UserContextKey      = "user"
+    TenantContextKey    = "tenant"
+    DeviceContextKey    = "device"
+    PeerContextKey      = "peer"
+    CallerContextKey    = "caller"
+    AmqpTenantHeader    = "x-tenant-id"
 )
@@ -0,0 +1,116 @@
+package common
+
+import (
+    "crypto/hmac"
+    "encoding/base64"
+    "errors"
+    "net/http"
+    "slices"
+    "time"
+
+    "github.com/goccy/go-json"
+)
+
+var (
+    ErrInvalidCursor    = NewAppError("invalid_cursor", http.StatusBadRequest, "Cursor is invalid")
+    ErrCursorExpired    = NewAppError("cursor_expired", http.StatusBadRequest, "Cursor has expired")
+    ErrInvalidCursorKey = errors.New("invalid cursor key")
+)
+
+const (
+    // cursorSignatureSize is the size of the hex encoded hmac that prefixes the payload
+    cursorSignatureSize = 64
+    // cursorSignaturePrefix separates the signatures of the cursors from the other signatures of the key
+    cursorSignaturePrefix = "cursor\n"
+)
+
+// Cursor is the position after the last item of a page, K holds the sort keys of that item,
+// like struct{ RecordedAt time.Time; ID string }
+type Cursor[K any] struct {
+    Keys K `json:"k"`
+    // Filters are the filters of the first page, so a cursor can't be used for another list
+    Filters []Filter `json:"f,omitempty"`
+    // ExpiresAt is set from the TTL of the codec if it is nil
+    ExpiresAt *time.Time `json:"e,omitempty"`
+}
+
+// MatchesFilters checks if the cursor was created for the filters, like the filters of ListQuery
+func (c *Cursor[K]) MatchesFilters(filters []Filter) bool {
+    return slices.EqualFunc(
+        c.Filters, filters, func(a, b Filter) bool {
+            // the times are parsed from the values, comparing the values is enough
+            return a.Field == b.Field && a.Operator == b.Operator && slices.Equal(a.Values, b.Values)
+        },
+    )
+}
+
+// CursorCodec signs the cursors with the key, so clients can't tamper with them
+type CursorCodec struct {
+    Key string
+    // TTL is how long the cursors are valid, they never expire if it is zero
+    TTL time.Duration
+}
+
+// NewCursorCodec creates a cursor codec, like so: NewCursorCodec(config.CursorKey, time.Hour)
+// the key must not be empty
+func NewCursorCodec(key string, ttl time.Duration) (*CursorCodec, error) {
+    if key == "" {
+        return nil, ErrInvalidCursorKey
+    }
+    return &CursorCodec{Key: key, TTL: ttl}, nil
+}
+
+// signCursor signs the payload of the cursor, the prefix keeps it from being a valid signature of another payload
+func signCursor(payload []byte, key string) string {
+    return sign(cursorSignaturePrefix+string(payload), key)
+}
+
+// EncodeCursor signs the cursor and encodes it as an opaque base64url string
+func EncodeCursor[K any](codec *CursorCodec, cursor *Cursor[K]) (string, error) {
+    if codec.Key == "" {
+        return "", ErrInvalidCursorKey
+    }
+
+    encoded := *cursor
+    if encoded.ExpiresAt == nil && codec.TTL > 0 {
+        expiresAt := time.Now().Add(codec.TTL).UTC()
+        encoded.ExpiresAt = &expiresAt
+    }
+
+    payload, err := json.Marshal(&encoded)
+    if err != nil {
+        return "", err
+    }
+
+    // the signature is inside the encoding, so the cursor is a single opaque token
+    signed := signCursor(payload, codec.Key) + string(payload)
+    return base64.RawURLEncoding.EncodeToString([]byte(signed)), nil
+}
+
+// DecodeCursor verifies the cursor and decodes it, like so:
+// cursor, err := DecodeCursor[PositionKeys](codec, query.Cursor)
+// tampered cursors are ErrInvalidCursor and expired ones ErrCursorExpired, a codec without a key ErrInvalidCursorKey
+func DecodeCursor[K any](codec *CursorCodec, raw string) (*Cursor[K], error) {
+    if codec.Key == "" {
+        return nil, ErrInvalidCursorKey
+    }
+
+    signed, err := base64.RawURLEncoding.DecodeString(raw)
+    if err != nil || len(signed) <= cursorSignatureSize {
+        return nil, ErrInvalidCursor
+    }
+
+    signature, payload := signed[:cursorSignatureSize], signed[cursorSignatureSize:]
+    if !hmac.Equal(signature, []byte(signCursor(payload, codec.Key))) {
+        return nil, ErrInvalidCursor
+    }
+
+    var cursor Cursor[K]
+    if err := json.Unmarshal(payload, &cursor); err != nil {
+        return nil, ErrInvalidCursor.Wrap(err)
+    }
+    if cursor.ExpiresAt != nil && time.Now().After(*cursor.ExpiresAt) {
+        return nil, ErrCursorExpired
+    }
+    return &cursor, nil
+}
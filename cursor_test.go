@@ -0,0 +1,118 @@
+package common
+
+import (
+    "encoding/base64"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+type testPositionKeys struct {
+    RecordedAt time.Time `json:"recorded_at"`
+    ID         string    `json:"id"`
+}
+
+func newTestCursorCodec(t *testing.T, key string, ttl time.Duration) *CursorCodec {
+    codec, err := NewCursorCodec(key, ttl)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return codec
+}
+
+func TestEncodeCursor(t *testing.T) {
+    codec := newTestCursorCodec(t, testSignatureKey, time.Hour)
+    filters := []Filter{{Field: "status", Operator: FilterIn, Values: []string{"active", "idle"}}}
+    keys := testPositionKeys{RecordedAt: time.Date(2024, 11, 16, 8, 0, 0, 0, time.UTC), ID: "p-1"}
+
+    raw, err := EncodeCursor(codec, &Cursor[testPositionKeys]{Keys: keys, Filters: filters})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(raw, "p-1") || strings.ContainsAny(raw, "+/=") {
+        t.Fatalf("Cursor should be opaque and url safe, got %s", raw)
+    }
+
+    cursor, err := DecodeCursor[testPositionKeys](codec, raw)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !cursor.Keys.RecordedAt.Equal(keys.RecordedAt) || cursor.Keys.ID != keys.ID {
+        t.Fatalf("Keys should be decoded, got %+v", cursor.Keys)
+    }
+    if !cursor.MatchesFilters(filters) || cursor.MatchesFilters(nil) {
+        t.Fatalf("Filters should be decoded, got %+v", cursor.Filters)
+    }
+    if cursor.ExpiresAt == nil {
+        t.Fatal("Expiry should be set from the TTL")
+    }
+
+    raw, err = EncodeCursor(newTestCursorCodec(t, testSignatureKey, 0), &Cursor[testPositionKeys]{Keys: keys})
+    if err != nil {
+        t.Fatal(err)
+    }
+    payload, err := base64.RawURLEncoding.DecodeString(raw)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(string(payload), `"e"`) {
+        t.Fatalf("Cursor without a TTL should not expire, got %s", payload)
+    }
+}
+
+func TestDecodeCursor_MustFail(t *testing.T) {
+    codec := newTestCursorCodec(t, testSignatureKey, 0)
+    raw, err := EncodeCursor(codec, &Cursor[testPositionKeys]{Keys: testPositionKeys{ID: "p-1"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tampered := []byte(raw)
+    tampered[len(tampered)-2] ^= 1
+
+    // the signature of the request signing with the same key must not be a valid cursor
+    payload := `{"k":{"recorded_at":"0001-01-01T00:00:00Z","id":"p-2"}}`
+    forged := base64.RawURLEncoding.EncodeToString([]byte(sign(payload, testSignatureKey) + payload))
+
+    tests := map[string]struct {
+        codec *CursorCodec
+        raw   string
+    }{
+        "tampered":  {codec, string(tampered)},
+        "wrong key": {newTestCursorCodec(t, "another-key", 0), raw},
+        "forged":    {codec, forged},
+        "malformed": {codec, "not a cursor"},
+        "truncated": {codec, raw[:20]},
+    }
+    for name, test := range tests {
+        t.Run(
+            name, func(t *testing.T) {
+                if _, err := DecodeCursor[testPositionKeys](test.codec, test.raw); !errors.Is(err, ErrInvalidCursor) {
+                    t.Fatalf("Cursor should be invalid, got %v", err)
+                }
+            },
+        )
+    }
+
+    expiresAt := time.Now().Add(-time.Minute)
+    expired, err := EncodeCursor(codec, &Cursor[testPositionKeys]{ExpiresAt: &expiresAt})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := DecodeCursor[testPositionKeys](codec, expired); !errors.Is(err, ErrCursorExpired) {
+        t.Fatalf("Cursor should be expired, got %v", err)
+    }
+}
+
+func TestNewCursorCodec_MustFail(t *testing.T) {
+    if _, err := NewCursorCodec("", time.Hour); !errors.Is(err, ErrInvalidCursorKey) {
+        t.Fatalf("Empty key should be rejected, got %v", err)
+    }
+    if _, err := EncodeCursor(&CursorCodec{}, &Cursor[testPositionKeys]{}); !errors.Is(err, ErrInvalidCursorKey) {
+        t.Fatalf("Cursor should not be signed without a key, got %v", err)
+    }
+    if _, err := DecodeCursor[testPositionKeys](&CursorCodec{}, "cursor"); !errors.Is(err, ErrInvalidCursorKey) {
+        t.Fatalf("Cursor should not be verified without a key, got %v", err)
+    }
+}
@@ -0,0 +1,134 @@
+package common
+
+import (
+    "math"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/go-playground/validator/v10"
+)
+
+var (
+    // vinPattern is the ISO 3779 vehicle identification number, I, O and Q are never used
+    vinPattern = regexp.MustCompile(`^[A-HJ-NPR-Z0-9]{17}$`)
+    // mmPlatePattern is a Myanmar license plate, like YGN 1A-2345, 2B/1234 or ၁က-၁၂၃၄,
+    // the region is optional and written in latin or burmese letters
+    mmPlatePattern = regexp.MustCompile(
+        `^(?:(?:[A-Z]{2,3}|[\x{1000}-\x{103F}]+)[ -])?` +
+            `(?:[0-9]{1,2}[A-Z]{1,2}|[\x{1040}-\x{1049}]{1,2}[\x{1000}-\x{1021}]{1,2})[-/ ]` +
+            `(?:[0-9]{4}|[\x{1040}-\x{1049}]{4})$`,
+    )
+)
+
+// RegisterFleetValidators adds the validation tags of the fleet data to the validator:
+//
+//	vin       the vehicle identification number, 17 characters without I, O and Q
+//	mm_plate  the Myanmar license plate number, like YGN 1A-2345
+//	imei      the 15 digits IMEI of a tracker, with a valid Luhn check digit
+//	latlng    the latitude and longitude pair, as "16.8409,96.1735" or two floats
+//	speed     the speed in km/h between 0 and the param, like speed=200
+func RegisterFleetValidators(validate *validator.Validate) error {
+    validators := map[string]validator.Func{
+        "vin":      isVIN,
+        "mm_plate": isMyanmarPlate,
+        "imei":     isIMEI,
+        "latlng":   isLatLng,
+        "speed":    isSpeed,
+    }
+    for tag, fn := range validators {
+        if err := validate.RegisterValidation(tag, fn); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func isVIN(fl validator.FieldLevel) bool {
+    return vinPattern.MatchString(strings.ToUpper(fl.Field().String()))
+}
+
+func isMyanmarPlate(fl validator.FieldLevel) bool {
+    return mmPlatePattern.MatchString(strings.TrimSpace(fl.Field().String()))
+}
+
+func isIMEI(fl validator.FieldLevel) bool {
+    imei := fl.Field().String()
+    if len(imei) != 15 {
+        return false
+    }
+    return luhnValid(imei)
+}
+
+// luhnValid checks the Luhn check digit of the digits, the last digit is the check digit
+func luhnValid(digits string) bool {
+    sum := 0
+    double := false
+    for i := len(digits) - 1; i >= 0; i-- {
+        digit := int(digits[i] - '0')
+        if digit < 0 || digit > 9 {
+            return false
+        }
+        if double {
+            digit *= 2
+            if digit > 9 {
+                digit -= 9
+            }
+        }
+        sum += digit
+        double = !double
+    }
+    return sum%10 == 0
+}
+
+func isLatLng(fl validator.FieldLevel) bool {
+    field := fl.Field()
+
+    var lat, lng float64
+    switch field.Kind() {
+    case reflect.String:
+        latText, lngText, ok := strings.Cut(field.String(), ",")
+        if !ok {
+            return false
+        }
+        var err error
+        if lat, err = strconv.ParseFloat(strings.TrimSpace(latText), 64); err != nil {
+            return false
+        }
+        if lng, err = strconv.ParseFloat(strings.TrimSpace(lngText), 64); err != nil {
+            return false
+        }
+    case reflect.Slice, reflect.Array:
+        if field.Len() != 2 || !field.Index(0).CanFloat() {
+            return false
+        }
+        lat, lng = field.Index(0).Float(), field.Index(1).Float()
+    default:
+        return false
+    }
+
+    return !math.IsNaN(lat) && !math.IsNaN(lng) && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+func isSpeed(fl validator.FieldLevel) bool {
+    // a missing param is a bug of the struct tag, like the params of the built-in tags
+    maxSpeed, err := strconv.ParseFloat(fl.Param(), 64)
+    if err != nil {
+        panic("speed requires the max speed in km/h, like speed=200: " + err.Error())
+    }
+
+    var speed float64
+    field := fl.Field()
+    switch {
+    case field.CanInt():
+        speed = float64(field.Int())
+    case field.CanUint():
+        speed = float64(field.Uint())
+    case field.CanFloat():
+        speed = field.Float()
+    default:
+        return false
+    }
+    return !math.IsNaN(speed) && speed >= 0 && speed <= maxSpeed
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+    "testing"
+)
+
+type FleetVehicle struct {
+    VIN      string     `json:"vin" validate:"vin"`
+    Plate    string     `json:"plate" validate:"mm_plate"`
+    IMEI     string     `json:"imei" validate:"imei"`
+    Position string     `json:"position" validate:"latlng"`
+    Point    [2]float64 `json:"point" validate:"latlng"`
+    Speed    float64    `json:"speed" validate:"speed=200"`
+}
+
+func TestRegisterFleetValidators(t *testing.T) {
+    validate := NewValidator()
+    if err := RegisterFleetValidators(validate); err != nil {
+        t.Fatal(err)
+    }
+
+    valid := FleetVehicle{
+        VIN:      "1HGCM82633A004352",
+        Plate:    "YGN 1A-2345",
+        IMEI:     "490154203237518",
+        Position: "16.8409, 96.1735",
+        Point:    [2]float64{21.9588, 96.0891},
+        Speed:    80.5,
+    }
+    if err := validate.Struct(&valid); err != nil {
+        t.Fatal(err)
+    }
+
+    plates := []string{"1A-2345", "2B/1234", "MDY 12AB-0001", "၁က-၁၂၃၄", "ရန်ကုန် ၉ည-၅၆၇၈"}
+    for _, plate := range plates {
+        if err := validate.Var(plate, "mm_plate"); err != nil {
+            t.Errorf("Plate %s should be valid, got %v", plate, err)
+        }
+    }
+}
+
+func TestRegisterFleetValidators_MustFail(t *testing.T) {
+    validate := NewValidator()
+    if err := RegisterFleetValidators(validate); err != nil {
+        t.Fatal(err)
+    }
+
+    err := validate.Struct(
+        &FleetVehicle{
+            VIN:      "1HGCM82633A00435O",
+            Plate:    "1A-234",
+            IMEI:     "490154203237519",
+            Position: "91,96.1735",
+            Point:    [2]float64{21.9588, 181},
+            Speed:    -1,
+        },
+    )
+
+    messages, ok := DefaultErrorResponse(err).Error.(map[string]string)
+    if !ok {
+        t.Fatalf("Validation errors should be set, got %v", err)
+    }
+    expected := map[string]string{
+        "vin":      "Invalid vehicle identification number",
+        "plate":    "Invalid license plate number",
+        "imei":     "Invalid imei number",
+        "position": "Invalid coordinates",
+        "point":    "Invalid coordinates",
+        "speed":    "Must be a speed between 0 and 200 km/h",
+    }
+    for key, message := range expected {
+        if messages[key] != message {
+            t.Errorf("Message of %s should be %q, got %q", key, message, messages[key])
+        }
+    }
+
+    if FormatValidationMessage("mm_plate") != "Invalid license plate number" {
+        t.Fatalf("Fleet tags should have messages, got %q", FormatValidationMessage("mm_plate"))
+    }
+    // without its param the message of speed has no limit to show
+    if FormatValidationMessage("speed") != "Invalid speed" {
+        t.Fatalf("Speed should have a message without its param, got %q", FormatValidationMessage("speed"))
+    }
+}
@@ -1,6 +1,10 @@
 package common
 
 import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+
     "golang.org/x/crypto/bcrypt"
 )
 
@@ -15,3 +19,16 @@ func CheckPasswordHash(password, hash string) bool {
     err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
     return err == nil
 }
+
+// HashAPIKey hashes the api key with a keyed hash,
+// bcrypt is too slow to run on every device request and api keys are random enough already
+func HashAPIKey(key, pepper string) string {
+    h := hmac.New(sha256.New, []byte(pepper))
+    h.Write([]byte(key))
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// CheckAPIKeyHash checks the api key hash in constant time
+func CheckAPIKeyHash(key, pepper, hash string) bool {
+    return hmac.Equal([]byte(HashAPIKey(key, pepper)), []byte(hash))
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+    "context"
+    "errors"
+)
+
+var (
+    ErrUnknownSignatureKey = errors.New("unknown signature key")
+)
+
+// KeyResolver resolves the signature keys of the calling service
+type KeyResolver interface {
+    // ResolveKeys returns every active key of the key id, more than one while a key is rotated,
+    // it returns ErrUnknownSignatureKey if the key id is unknown or revoked
+    ResolveKeys(ctx context.Context, keyID string) ([]string, error)
+}
+
+// StaticKeyResolver resolves the keys from a fixed map of key id to keys,
+// like so: StaticKeyResolver{"vehicle-service": {newKey, oldKey}}
+type StaticKeyResolver map[string][]string
+
+// ResolveKeys implements KeyResolver
+func (s StaticKeyResolver) ResolveKeys(_ context.Context, keyID string) ([]string, error) {
+    keys, ok := s[keyID]
+    if !ok || len(keys) == 0 {
+        return nil, ErrUnknownSignatureKey
+    }
+    return keys, nil
+}
+
+// CallerFromContext returns the key id of the caller verified by VerifySignatureMiddlewareWithConfig
+func CallerFromContext(ctx context.Context) (string, bool) {
+    caller, ok := ctx.Value(CallerContextKey).(string)
+    return caller, ok && caller != ""
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func newKeyResolverServer(t *testing.T) *httptest.Server {
+    return httptest.NewServer(
+        VerifySignatureMiddlewareWithConfig(
+            &SignatureConfig{
+                KeyResolver: StaticKeyResolver{
+                    // the new key is rolled out while the old key is still in use
+                    "vehicle-service": {"vehicle-key-new", "vehicle-key-old"},
+                    "driver-service":  {"driver-key"},
+                },
+            },
+        )(
+            http.HandlerFunc(
+                func(w http.ResponseWriter, r *http.Request) {
+                    caller, ok := CallerFromContext(r.Context())
+                    if !ok {
+                        t.Error("Caller should be in the context")
+                    }
+                    _, _ = w.Write([]byte(caller))
+                },
+            ),
+        ),
+    )
+}
+
+func TestVerifySignatureMiddleware_KeyResolver(t *testing.T) {
+    server := newKeyResolverServer(t)
+    defer server.Close()
+
+    for keyID, key := range map[string]string{
+        "vehicle-service": "vehicle-key-old",
+        "driver-service":  "driver-key",
+    } {
+        client := NewSigningClientWithKeyID(HttpClient, keyID, key)
+        res, err := client.Post(server.URL, ApplicationJSON, bytes.NewReader([]byte("{}")))
+        if err != nil {
+            t.Fatal(err)
+        }
+        buf := new(bytes.Buffer)
+        _, _ = buf.ReadFrom(res.Body)
+        _ = res.Body.Close()
+
+        if res.StatusCode != http.StatusOK {
+            t.Fatalf("Status should be 200, got %d", res.StatusCode)
+        }
+        if buf.String() != keyID {
+            t.Fatalf("Caller should be %s, got %s", keyID, buf.String())
+        }
+    }
+}
+
+func TestVerifySignatureMiddleware_KeyResolver_MustFail(t *testing.T) {
+    server := newKeyResolverServer(t)
+    defer server.Close()
+
+    tests := []struct {
+        name   string
+        client *http.Client
+        status int
+    }{
+        {"unknown caller", NewSigningClientWithKeyID(HttpClient, "trip-service", "trip-key"), http.StatusUnauthorized},
+        {"key of another caller", NewSigningClientWithKeyID(HttpClient, "vehicle-service", "driver-key"), http.StatusBadRequest},
+        {"without key id", NewSigningClient(HttpClient, "driver-key"), http.StatusUnauthorized},
+    }
+
+    for _, test := range tests {
+        t.Run(
+            test.name, func(t *testing.T) {
+                res, err := test.client.Post(server.URL, ApplicationJSON, bytes.NewReader([]byte("{}")))
+                if err != nil {
+                    t.Fatal(err)
+                }
+                _ = res.Body.Close()
+                if res.StatusCode != test.status {
+                    t.Fatalf("Status should be %d, got %d", test.status, res.StatusCode)
+                }
+            },
+        )
+    }
+}
@@ -0,0 +1,261 @@
+package common
+
+import (
+    "fmt"
+    "maps"
+    "math"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    defaultListLimit = 20
+    maxListLimit     = 100
+)
+
+// FilterOperator compares a field with the values of a filter, like so: ?status[in]=active,idle
+type FilterOperator string
+
+const (
+    FilterEq      FilterOperator = "eq"
+    FilterIn      FilterOperator = "in"
+    FilterGte     FilterOperator = "gte"
+    FilterLte     FilterOperator = "lte"
+    FilterBetween FilterOperator = "between"
+)
+
+// FilterField describes a field the clients may filter by
+type FilterField struct {
+    // Operators are the allowed operators, eq only if empty
+    Operators []FilterOperator
+    // Time parses the values as RFC3339 times, like the bounds of a between
+    Time bool
+}
+
+// ListQueryConfig whitelists the sort and filter fields of a list endpoint
+type ListQueryConfig struct {
+    // DefaultLimit is used if the limit is not set, 20 by default
+    DefaultLimit int
+    // MaxLimit caps the limit, 100 by default
+    MaxLimit int
+    // SortFields are the fields the clients may sort by
+    SortFields []string
+    // DefaultSort is used if the sort is not set, like "-created_at"
+    DefaultSort string
+    // Filters are the fields the clients may filter by, keyed by their query param
+    Filters map[string]FilterField
+}
+
+// SortField is a field of the sort, like -created_at is created_at descending
+type SortField struct {
+    Field string
+    Desc  bool
+}
+
+// Filter is a parsed filter, Times is set for the time fields, it is not encoded since the values hold it
+type Filter struct {
+    Field    string         `json:"field"`
+    Operator FilterOperator `json:"operator"`
+    Values   []string       `json:"values"`
+    Times    []time.Time    `json:"-"`
+}
+
+// ListQuery is the validated pagination, sort and filters of a list request,
+// Cursor is set for cursor pagination and Offset for offset pagination
+type ListQuery struct {
+    Limit   int
+    Offset  int
+    Cursor  string
+    Sort    []SortField
+    Filters []Filter
+}
+
+// Filter returns the filter of the field with the operator
+func (q *ListQuery) Filter(field string, operator FilterOperator) (Filter, bool) {
+    for _, filter := range q.Filters {
+        if filter.Field == field && filter.Operator == operator {
+            return filter, true
+        }
+    }
+    return Filter{}, false
+}
+
+// ParseListQuery parses the pagination, sort and filters of the request, like so:
+// ?limit=20&offset=40&sort=-recorded_at,plate&status[in]=active,idle&recorded_at[gte]=2024-11-01T00:00:00Z,
+// the page param is converted to the offset, filters without an operator are eq and params that are
+// not filters are ignored, repeated params are invalid, use the in operator for many values,
+// the errors are ErrValidation wrapping the FieldErrors of the invalid params, a nil config is the defaults,
+// which allow no sort and no filters
+func ParseListQuery(r *http.Request, config *ListQueryConfig) (*ListQuery, error) {
+    if config == nil {
+        config = &ListQueryConfig{}
+    }
+    query := r.URL.Query()
+    errs := make(FieldErrors)
+
+    defaultLimit := config.DefaultLimit
+    if defaultLimit <= 0 {
+        defaultLimit = defaultListLimit
+    }
+    maxLimit := config.MaxLimit
+    if maxLimit <= 0 {
+        maxLimit = maxListLimit
+    }
+
+    // query.Get drops the other values of a repeated param, so they are rejected instead
+    repeated := func(param string) bool {
+        if len(query[param]) > 1 {
+            errs[param] = "Must not be repeated"
+            return true
+        }
+        return false
+    }
+
+    listQuery := &ListQuery{Limit: defaultLimit}
+    if !repeated(QueryCursor) {
+        listQuery.Cursor = query.Get(QueryCursor)
+    }
+
+    parseNumber := func(param string, minimum int) (int, bool) {
+        raw := query.Get(param)
+        if raw == "" || repeated(param) {
+            return 0, false
+        }
+        n, err := strconv.Atoi(raw)
+        if err != nil || n < minimum {
+            errs[param] = fmt.Sprintf("Must be a number of at least %d", minimum)
+            return 0, false
+        }
+        return n, true
+    }
+
+    if limit, ok := parseNumber(QueryLimit, 1); ok {
+        if limit > maxLimit {
+            errs[QueryLimit] = fmt.Sprintf("Must be at most %d", maxLimit)
+        }
+        listQuery.Limit = limit
+    }
+    if offset, ok := parseNumber(QueryOffset, 0); ok {
+        listQuery.Offset = offset
+    }
+    if page, ok := parseNumber(QueryPage, 1); ok {
+        if query.Has(QueryOffset) {
+            errs[QueryPage] = "Must not be used with offset"
+        }
+        // the offset of a huge page would overflow
+        if page-1 > math.MaxInt/listQuery.Limit {
+            errs[QueryPage] = "Must be a smaller page"
+        } else {
+            listQuery.Offset = (page - 1) * listQuery.Limit
+        }
+    }
+    if listQuery.Cursor != "" && (query.Has(QueryOffset) || query.Has(QueryPage)) {
+        errs[QueryCursor] = "Must not be used with offset or page"
+    }
+
+    sort := query.Get(QuerySort)
+    if sort == "" {
+        sort = config.DefaultSort
+    }
+    if !repeated(QuerySort) {
+        listQuery.Sort = parseSortFields(sort, config.SortFields, errs)
+    }
+
+    // the params are walked in order, so the filters and the errors are the same for the same query
+    for _, param := range slices.Sorted(maps.Keys(query)) {
+        field, operator := param, FilterEq
+        if name, op, ok := strings.Cut(param, "["); ok && strings.HasSuffix(op, "]") {
+            field, operator = name, FilterOperator(strings.TrimSuffix(op, "]"))
+        }
+
+        filterField, ok := config.Filters[field]
+        if !ok {
+            // bracket params are meant as filters, so the client should know they are not applied
+            if field != param {
+                errs[param] = "Filtering by " + field + " is not allowed"
+            }
+            continue
+        }
+        if repeated(param) {
+            continue
+        }
+
+        filter, err := parseFilter(field, operator, filterField, query.Get(param))
+        if err != "" {
+            errs[param] = err
+            continue
+        }
+        listQuery.Filters = append(listQuery.Filters, filter)
+    }
+
+    if len(errs) > 0 {
+        return nil, ErrValidation.Wrap(errs)
+    }
+    return listQuery, nil
+}
+
+// parseSortFields parses the comma separated sort, a leading "-" sorts descending
+func parseSortFields(sort string, allowed []string, errs FieldErrors) []SortField {
+    var fields []SortField
+    for _, part := range strings.Split(sort, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+        if !slices.Contains(allowed, field.Field) {
+            errs[QuerySort] = "Sorting by " + field.Field + " is not allowed"
+            continue
+        }
+        fields = append(fields, field)
+    }
+    return fields
+}
+
+// parseFilter parses the value of the filter, the error is the message for the client
+func parseFilter(field string, operator FilterOperator, filterField FilterField, raw string) (Filter, string) {
+    operators := filterField.Operators
+    if len(operators) == 0 {
+        operators = []FilterOperator{FilterEq}
+    }
+    if !slices.Contains(operators, operator) {
+        return Filter{}, fmt.Sprintf("Operator %s is not allowed for %s", operator, field)
+    }
+
+    values := []string{raw}
+    switch operator {
+    case FilterIn:
+        values = strings.Split(raw, ",")
+    case FilterBetween:
+        values = strings.Split(raw, ",")
+        if len(values) != 2 {
+            return Filter{}, "Must be two values separated by a comma"
+        }
+    }
+    for i, value := range values {
+        values[i] = strings.TrimSpace(value)
+        if values[i] == "" {
+            return Filter{}, "Must not be empty"
+        }
+    }
+
+    filter := Filter{Field: field, Operator: operator, Values: values}
+    if !filterField.Time {
+        return filter, ""
+    }
+
+    for _, value := range values {
+        t, err := time.Parse(time.RFC3339, value)
+        if err != nil {
+            return Filter{}, "Must be an RFC3339 time"
+        }
+        filter.Times = append(filter.Times, t)
+    }
+    if operator == FilterBetween && filter.Times[1].Before(filter.Times[0]) {
+        return Filter{}, "The end must not be before the start"
+    }
+    return filter, ""
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/goccy/go-json"
+)
+
+var testListQueryConfig = &ListQueryConfig{
+    SortFields:  []string{"recorded_at", "plate"},
+    DefaultSort: "-recorded_at",
+    Filters: map[string]FilterField{
+        "status":      {Operators: []FilterOperator{FilterEq, FilterIn}},
+        "recorded_at": {Operators: []FilterOperator{FilterGte, FilterLte, FilterBetween}, Time: true},
+    },
+}
+
+func TestParseListQuery(t *testing.T) {
+    r := httptest.NewRequest(
+        http.MethodGet,
+        "/positions?limit=10&page=3&sort=plate,-recorded_at&status[in]=active,idle&expand=driver"+
+            "&recorded_at[between]=2024-11-01T00:00:00Z,2024-11-02T00:00:00Z",
+        nil,
+    )
+
+    query, err := ParseListQuery(r, testListQueryConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if query.Limit != 10 || query.Offset != 20 {
+        t.Fatalf("Page should be converted to the offset, got %d %d", query.Limit, query.Offset)
+    }
+    if !reflect.DeepEqual(query.Sort, []SortField{{Field: "plate"}, {Field: "recorded_at", Desc: true}}) {
+        t.Fatalf("Sort should keep its order, got %+v", query.Sort)
+    }
+
+    status, ok := query.Filter("status", FilterIn)
+    if !ok || !reflect.DeepEqual(status.Values, []string{"active", "idle"}) {
+        t.Fatalf("In filter should split the values, got %+v", status)
+    }
+
+    recordedAt, ok := query.Filter("recorded_at", FilterBetween)
+    expected := []time.Time{time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC)}
+    if !ok || !reflect.DeepEqual(recordedAt.Times, expected) {
+        t.Fatalf("Between filter should parse the times, got %+v", recordedAt)
+    }
+}
+
+func TestParseListQuery_Defaults(t *testing.T) {
+    r := httptest.NewRequest(http.MethodGet, "/positions?status=active&cursor=abc", nil)
+
+    query, err := ParseListQuery(r, testListQueryConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if query.Limit != defaultListLimit || query.Cursor != "abc" {
+        t.Fatalf("Default limit and cursor should be set, got %+v", query)
+    }
+    if !reflect.DeepEqual(query.Sort, []SortField{{Field: "recorded_at", Desc: true}}) {
+        t.Fatalf("Default sort should be used, got %+v", query.Sort)
+    }
+    if _, ok := query.Filter("status", FilterEq); !ok {
+        t.Fatalf("Filter without an operator should be eq, got %+v", query.Filters)
+    }
+
+    // a nil config is the defaults, the pagination is parsed and the other params are ignored
+    query, err = ParseListQuery(httptest.NewRequest(http.MethodGet, "/positions?limit=5&status=active", nil), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if query.Limit != 5 || len(query.Filters) != 0 {
+        t.Fatalf("Nil config should use the defaults, got %+v", query)
+    }
+}
+
+func TestParseListQuery_MustFail(t *testing.T) {
+    tests := map[string]string{
+        "limit":                "limit=1000",
+        "offset":               "offset=-1",
+        "cursor":               "cursor=abc&offset=10",
+        "page":                 "page=9223372036854775807&limit=10",
+        "status":               "status=active&status=idle",
+        "status[in]":           "status[in]=active&status[in]=idle",
+        "sort":                 "sort=driver",
+        "status[gte]":          "status[gte]=active",
+        "driver[eq]":           "driver[eq]=d-1",
+        "recorded_at[gte]":     "recorded_at[gte]=yesterday",
+        "recorded_at[between]": "recorded_at[between]=2024-11-02T00:00:00Z,2024-11-01T00:00:00Z",
+    }
+
+    for param, rawQuery := range tests {
+        t.Run(
+            param, func(t *testing.T) {
+                r := httptest.NewRequest(http.MethodGet, "/positions?"+rawQuery, nil)
+                _, err := ParseListQuery(r, testListQueryConfig)
+                if !errors.Is(err, ErrValidation) {
+                    t.Fatalf("Query should fail the validation, got %v", err)
+                }
+
+                response := DefaultErrorResponse(err)
+                if errs, ok := response.Error.(map[string]string); !ok || errs[param] == "" {
+                    t.Fatalf("Error of %s should be in the response, got %+v", param, response.Error)
+                }
+            },
+        )
+    }
+}
+
+func TestParseListQuery_ProblemDetails(t *testing.T) {
+    // the params share their names with the members of the problem, like status, so they must not be top level
+    r := httptest.NewRequest(http.MethodGet, "/positions?status=active&status=idle&limit=1000", nil)
+    _, err := ParseListQuery(r, testListQueryConfig)
+    if err == nil {
+        t.Fatal("Query should fail the validation")
+    }
+
+    r.Header.Set("Accept", ApplicationProblemJSON)
+    w := httptest.NewRecorder()
+    ErrorNegotiationMiddleware(errorHandler(err)).ServeHTTP(w, r)
+
+    var problem ProblemDetails
+    if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+        t.Fatal(err)
+    }
+    if problem.Status != http.StatusBadRequest || problem.Code != ErrValidation.Code {
+        t.Fatalf("Problem should be the validation error, got %s", w.Body.String())
+    }
+    if problem.Errors["status"] != "Must not be repeated" || problem.Errors["limit"] == "" {
+        t.Fatalf("Errors of the params should be in the errors member, got %s", w.Body.String())
+    }
+}
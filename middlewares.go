@@ -4,32 +4,75 @@ import (
     "bytes"
     "context"
     "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
     "errors"
     "io"
     "log"
     "net/http"
+    "os"
+    "strconv"
     "time"
 
     "github.com/goccy/go-json"
 )
 
 var (
-    ErrSignatureMismatch = errors.New("signature mismatch")
+    ErrSignatureMismatch           = errors.New("signature mismatch")
+    ErrSignatureExpired            = errors.New("signature timestamp is outside the allowed window")
+    ErrSignatureNonceRequired      = errors.New("signature nonce is required")
+    ErrSignatureReplayed           = errors.New("signature nonce has already been used")
+    ErrUnsupportedSignatureVersion = errors.New("unsupported signature version")
+    ErrRequestBodyTooLarge         = errors.New("request body is too large")
+    ErrBodyDigestMismatch          = errors.New("body digest mismatch")
+)
+
+const (
+    defaultSignatureWindow = 5 * time.Minute
+    defaultMaxBodySize     = 10 << 20
 )
 
 var (
     HttpClient = &http.Client{
         // 4 seconds is more than enough 
-        Timeout: 4 * time.Second,
+        Timeout:   4 * time.Second,
+        // forwards the tenant of the request context to other services
+        Transport: &TenantTransport{},
     }
 )
 
-// HandleError is a helper function to handle error responses
+// HandleError is a helper function to handle error responses, a zero status is derived from the error,
+// only the safe message of the AppError is sent and the cause of internal errors is logged, see MapError,
+// behind ErrorNegotiationMiddleware the clients that ask for it get problem details instead
 func HandleError(statusCode int, w http.ResponseWriter, err error) {
-    w.WriteHeader(statusCode)
-    if err := json.NewEncoder(w).Encode(DefaultErrorResponse(err)); err != nil {
-        log.Println("Failed to encode error response", err)
+    appErr := resolveAppError(statusCode, err)
+    if appErr.Status >= http.StatusInternalServerError {
+        log.Println("Internal error", err)
+    }
+
+    locale := DefaultLocale
+    writer, negotiated := errorWriterOf(w)
+    if negotiated {
+        locale = writer.locale
+    }
+
+    if negotiated && writer.problem {
+        problem := newProblemDetails(appErr, locale)
+        problem.Instance = writer.instance
+        w.Header().Set(ContentType, ApplicationProblemJSON)
+        w.WriteHeader(appErr.Status)
+        if err := json.NewEncoder(w).Encode(problem); err != nil {
+            log.Println("Failed to encode error response", err)
+        }
+        return
     }
+
+    WriteJSON(w, appErr.Status, newErrorResponse(appErr, locale))
+}
+
+// WriteError writes the error response with the status derived from the error
+func WriteError(w http.ResponseWriter, err error) {
+    HandleError(0, w, err)
 }
 
 type middlewareChan[T any] struct {
@@ -102,8 +145,45 @@ func LoggingMiddleware(
     }
 }
 
+// SignatureConfig configures VerifySignatureMiddlewareWithConfig
+type SignatureConfig struct {
+    // Key is the shared key, it is used for requests without X-Signature-Key-Id
+    Key string
+    // KeyResolver resolves the keys of the caller named by X-Signature-Key-Id
+    KeyResolver KeyResolver
+    // Window is how far the signature timestamp may be from now, 5 minutes by default
+    Window time.Duration
+    // NonceStore rejects reused nonces, an in-memory store is used by default
+    NonceStore NonceStore
+    // RequireReplayProtection rejects version 1 signatures once every client has migrated
+    RequireReplayProtection bool
+    // MaxBodySize is the largest accepted body in bytes, 10 MB by default and unlimited if negative
+    MaxBodySize int64
+    // StreamBody spools the body to a temp file instead of memory when a version 2 request
+    // declares X-Content-SHA256, the handler reads it from r.Body and it is not set in the context
+    StreamBody bool
+}
+
 // VerifySignatureMiddleware verifies the signature of the request
 func VerifySignatureMiddleware(signatureKey string) func(http.Handler) http.Handler {
+    return VerifySignatureMiddlewareWithConfig(&SignatureConfig{Key: signatureKey})
+}
+
+// VerifySignatureMiddlewareWithConfig verifies the signature of the request,
+// version 2 signatures are only accepted within the window and once per nonce,
+// the key id of the caller is set in the context when a KeyResolver is used
+func VerifySignatureMiddlewareWithConfig(signatureConfig *SignatureConfig) func(http.Handler) http.Handler {
+    // copy the config, so setting the defaults doesn't change the caller's config
+    config := *signatureConfig
+    if config.Window <= 0 {
+        config.Window = defaultSignatureWindow
+    }
+    if config.NonceStore == nil {
+        config.NonceStore = NewMemoryNonceStore()
+    }
+    if config.MaxBodySize == 0 {
+        config.MaxBodySize = defaultMaxBodySize
+    }
     return func(next http.Handler) http.Handler {
         return http.HandlerFunc(
             func(w http.ResponseWriter, r *http.Request) {
@@ -117,6 +197,52 @@ func VerifySignatureMiddleware(signatureKey string) func(http.Handler) http.Hand
                     return
                 }
 
+                version := r.Header.Get(XSignatureVersion)
+                if version == "" {
+                    version = SignatureV1
+                }
+
+                if version != SignatureV1 && version != SignatureV2 {
+                    HandleError(http.StatusBadRequest, w, ErrUnsupportedSignatureVersion)
+                    return
+                }
+
+                if version == SignatureV1 && config.RequireReplayProtection {
+                    HandleError(http.StatusBadRequest, w, ErrUnsupportedSignatureVersion)
+                    return
+                }
+
+                timestamp := r.Header.Get(XSignatureTimestamp)
+                nonce := r.Header.Get(XSignatureNonce)
+
+                // check the window before reading the body, stale requests are cheap to reject
+                if version == SignatureV2 {
+                    if nonce == "" {
+                        HandleError(http.StatusBadRequest, w, ErrSignatureNonceRequired)
+                        return
+                    }
+                    if err := checkSignatureTimestamp(timestamp, config.Window); err != nil {
+                        HandleError(http.StatusBadRequest, w, err)
+                        return
+                    }
+                }
+
+                // the caller is resolved before reading the body, unknown callers are cheap to reject
+                // the key id is ignored without a resolver, it would only be an unverified claim
+                keyID := ""
+                if config.KeyResolver != nil {
+                    keyID = r.Header.Get(XSignatureKeyID)
+                }
+                keys, err := resolveSignatureKeys(r.Context(), &config, keyID)
+                if err != nil {
+                    if errors.Is(err, ErrUnknownSignatureKey) {
+                        HandleError(http.StatusUnauthorized, w, err)
+                        return
+                    }
+                    HandleError(http.StatusInternalServerError, w, err)
+                    return
+                }
+
                 params := r.URL.Query()
 
                 defer func(Body io.ReadCloser) {
@@ -126,39 +252,162 @@ func VerifySignatureMiddleware(signatureKey string) func(http.Handler) http.Hand
                     }
                 }(r.Body)
 
-                // instead of io.ReadAll, we use a buffer to read the body (more efficient)
+                bodyReader := r.Body
+                if config.MaxBodySize > 0 {
+                    // reject declared sizes before reading anything
+                    if r.ContentLength > config.MaxBodySize {
+                        HandleError(http.StatusRequestEntityTooLarge, w, ErrRequestBodyTooLarge)
+                        return
+                    }
+                    bodyReader = http.MaxBytesReader(w, r.Body, config.MaxBodySize)
+                }
+
+                declaredDigest := r.Header.Get(XContentSHA256)
+
+                // with a declared digest large bodies are spooled to a temp file instead of memory,
+                // either way the whole body is verified before the signature and the handler see it
+                var sink io.Writer
                 buf := new(bytes.Buffer)
+                sink = buf
+                var spool *os.File
+                if version == SignatureV2 && declaredDigest != "" && config.StreamBody {
+                    spool, err = os.CreateTemp("", "signed-body-*")
+                    if err != nil {
+                        HandleError(http.StatusInternalServerError, w, err)
+                        return
+                    }
+                    defer removeSpool(spool)
+                    sink = spool
+                }
 
-                _, err := buf.ReadFrom(r.Body)
+                // we hash the body while reading, so the body is only read once
+                hasher := sha256.New()
+                _, err = io.Copy(io.MultiWriter(sink, hasher), bodyReader)
                 if err != nil {
+                    var maxBytesErr *http.MaxBytesError
+                    if errors.As(err, &maxBytesErr) {
+                        HandleError(http.StatusRequestEntityTooLarge, w, ErrRequestBodyTooLarge)
+                        return
+                    }
                     HandleError(http.StatusUnprocessableEntity, w, err)
                     return
                 }
 
-                body := buf.Bytes()
+                bodyDigest := hex.EncodeToString(hasher.Sum(nil))
+                if declaredDigest != "" && !hmac.Equal([]byte(declaredDigest), []byte(bodyDigest)) {
+                    HandleError(http.StatusBadRequest, w, ErrBodyDigestMismatch)
+                    return
+                }
 
-                // Since the body is read, we can't read it again
-                // So we put it back in the request
-                r = r.WithContext(context.WithValue(r.Context(), Body, body))
+                var body []byte
+                if spool != nil {
+                    if _, err := spool.Seek(0, io.SeekStart); err != nil {
+                        HandleError(http.StatusInternalServerError, w, err)
+                        return
+                    }
+                    r.Body = spool
+                } else {
+                    body = buf.Bytes()
+                    // Since the body is read, we can't read it again
+                    // So we put it back in the request
+                    r = r.WithContext(context.WithValue(r.Context(), Body, body))
+                }
 
-                expectedSignature, err := GenerateSignature(r.Method, r.URL.Path, params, body, signatureKey)
+                signedRequest := &SignedRequest{
+                    Method:        r.Method,
+                    Host:          r.Host,
+                    Path:          r.URL.Path,
+                    Params:        params,
+                    Header:        r.Header,
+                    SignedHeaders: ParseSignedHeaders(r.Header.Get(XSignatureHeaders)),
+                    BodyDigest:    bodyDigest,
+                }
 
-                if err != nil {
-                    HandleError(http.StatusUnprocessableEntity, w, err)
-                    return
+                // during a rotation the caller has more than one active key
+                matched := false
+                for _, key := range keys {
+                    var expectedSignature string
+                    if version == SignatureV2 {
+                        expectedSignature, err = GenerateSignatureV2(signedRequest, key)
+                    } else {
+                        expectedSignature, err = GenerateSignature(r.Method, r.URL.Path, params, body, key)
+                    }
+
+                    if err != nil {
+                        HandleError(http.StatusUnprocessableEntity, w, err)
+                        return
+                    }
+
+                    if hmac.Equal([]byte(providedSignature), []byte(expectedSignature)) {
+                        matched = true
+                        break
+                    }
                 }
 
-                if !hmac.Equal([]byte(providedSignature), []byte(expectedSignature)) {
+                if !matched {
                     HandleError(http.StatusBadRequest, w, ErrSignatureMismatch)
                     return
                 }
 
+                // the nonce is only recorded for valid signatures,
+                // otherwise anyone could burn the nonces of other callers
+                if version == SignatureV2 {
+                    // the timestamp may be up to a window in the future, so the nonce must outlive both sides
+                    // nonces are per caller, so two callers can't collide
+                    fresh, err := config.NonceStore.Use(r.Context(), keyID+":"+nonce, 2*config.Window)
+                    if err != nil {
+                        HandleError(http.StatusInternalServerError, w, err)
+                        return
+                    }
+                    if !fresh {
+                        HandleError(http.StatusBadRequest, w, ErrSignatureReplayed)
+                        return
+                    }
+                }
+
+                if keyID != "" {
+                    r = r.WithContext(context.WithValue(r.Context(), CallerContextKey, keyID))
+                }
+
                 next.ServeHTTP(w, r)
             },
         )
     }
 }
 
+// resolveSignatureKeys returns the keys the signature may be signed with,
+// requests without a key id fall back to the shared key
+func resolveSignatureKeys(ctx context.Context, config *SignatureConfig, keyID string) ([]string, error) {
+    if keyID == "" || config.KeyResolver == nil {
+        // without a shared key every caller must send its key id
+        if config.KeyResolver != nil && config.Key == "" {
+            return nil, ErrUnknownSignatureKey
+        }
+        return []string{config.Key}, nil
+    }
+    keys, err := config.KeyResolver.ResolveKeys(ctx, keyID)
+    if err != nil {
+        return nil, err
+    }
+    if len(keys) == 0 {
+        return nil, ErrUnknownSignatureKey
+    }
+    return keys, nil
+}
+
+// checkSignatureTimestamp checks the unix timestamp is within the window of now
+func checkSignatureTimestamp(timestamp string, window time.Duration) error {
+    seconds, err := strconv.ParseInt(timestamp, 10, 64)
+    if err != nil {
+        return ErrSignatureExpired
+    }
+    diff := time.Since(time.Unix(seconds, 0))
+    if diff > window || diff < -window {
+        return ErrSignatureExpired
+    }
+    return nil
+}
+
 // AuthorizationMiddleware is a middleware that verifies the token
 // and sets the result in the context
 func AuthorizationMiddleware[T any](url, signatureKey string) func(http.Handler) http.Handler {
@@ -170,10 +419,10 @@ func AuthorizationMiddleware[T any](url, signatureKey string) func(http.Handler)
                 result := make(chan middlewareResponse, 1)
 
                 // For concurrency, we run the request in a goroutine 
-                go func(url, authorization, signatureKey string, result chan<- middlewareResponse) {
+                go func(ctx context.Context, url, authorization, signatureKey string, result chan<- middlewareResponse) {
                     defer close(result)
                     // Prepare the request to validate the token
-                    request, err := http.NewRequest(http.MethodGet, url, nil)
+                    request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
                     if err != nil {
                         result <- middlewareResponse{Err: err, StatusCode: http.StatusInternalServerError}
                         // HandleError(http.StatusInternalServerError, w, err)
@@ -182,15 +431,14 @@ func AuthorizationMiddleware[T any](url, signatureKey string) func(http.Handler)
                     request.Header.Set(ContentType, ApplicationJSON)
                     // Add authorization header to the request 
                     request.Header.Set(Authorization, authorization)
-                    // Sign the request 
-                    sign, err := GenerateSignature(request.Method, request.URL.Path, nil, nil, signatureKey)
+                    // Sign the request with a version 2 signature, so services that require
+                    // replay protection accept it, the token is signed too
+                    err = SignRequest(request, nil, "", signatureKey, []string{ContentType, Authorization})
                     if err != nil {
                         result <- middlewareResponse{Err: err, StatusCode: http.StatusInternalServerError}
                         // HandleError(http.StatusInternalServerError, w, err)
                         return
                     }
-                    // Add the signature to the request header
-                    request.Header.Set(XSignature, sign)
                     // Send the request
                     res, err := HttpClient.Do(request)
                     if err != nil {
@@ -211,7 +459,7 @@ func AuthorizationMiddleware[T any](url, signatureKey string) func(http.Handler)
                         return
                     }
                     result <- middlewareResponse{Value: buf.Bytes(), StatusCode: res.StatusCode}
-                }(url, r.Header.Get(Authorization), signatureKey, result)
+                }(r.Context(), url, r.Header.Get(Authorization), signatureKey, result)
 
                 res := <-result
 
@@ -249,3 +497,14 @@ func AuthorizationMiddleware[T any](url, signatureKey string) func(http.Handler)
         )
     }
 }
+
+// removeSpool closes and removes the temp file of a spooled body
+func removeSpool(spool *os.File) {
+    // the handler may have closed it already
+    if err := spool.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+        log.Println("Error closing spooled body", err)
+    }
+    if err := os.Remove(spool.Name()); err != nil {
+        log.Println("Error removing spooled body", err)
+    }
+}
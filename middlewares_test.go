@@ -0,0 +1,250 @@
+package common
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+    "time"
+
+    "github.com/goccy/go-json"
+)
+
+const testSignatureKey = "test-signature-key"
+
+func okHandler() http.Handler {
+    return http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(http.StatusOK)
+        },
+    )
+}
+
+func newSignedRequestV2(t *testing.T, body []byte, timestamp time.Time, nonce string) *http.Request {
+    r := httptest.NewRequest(http.MethodPost, "/vehicles?type=truck&type=van", bytes.NewReader(body))
+    r.Header.Set(ContentType, ApplicationJSON)
+    r.Header.Set(XSignatureVersion, SignatureV2)
+    r.Header.Set(XSignatureTimestamp, SignatureTimestamp(timestamp))
+    r.Header.Set(XSignatureNonce, nonce)
+    r.Header.Set(XSignatureHeaders, "content-type")
+    signature, err := GenerateSignatureV2(
+        &SignedRequest{
+            Method:        r.Method,
+            Path:          r.URL.Path,
+            Params:        r.URL.Query(),
+            Header:        r.Header,
+            SignedHeaders: []string{ContentType},
+            BodyDigest:    BodyDigest(body),
+        }, testSignatureKey,
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    r.Header.Set(XSignature, signature)
+    return r
+}
+
+func TestVerifySignatureMiddleware_V1(t *testing.T) {
+    body := []byte("{\"name\": \"truck\"}")
+    r := httptest.NewRequest(http.MethodPost, "/vehicles", bytes.NewReader(body))
+    signature, err := GenerateSignature(r.Method, r.URL.Path, url.Values{}, body, testSignatureKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r.Header.Set(XSignature, signature)
+
+    w := httptest.NewRecorder()
+    VerifySignatureMiddleware(testSignatureKey)(okHandler()).ServeHTTP(w, r)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", w.Code)
+    }
+}
+
+func TestVerifySignatureMiddleware_V2(t *testing.T) {
+    handler := VerifySignatureMiddleware(testSignatureKey)(okHandler())
+    body := []byte("{\"name\": \"truck\"}")
+
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, newSignedRequestV2(t, body, time.Now(), "nonce-1"))
+    if w.Code != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", w.Code)
+    }
+
+    // the same request must not be accepted twice
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, newSignedRequestV2(t, body, time.Now(), "nonce-1"))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Replayed request should be rejected, got %d", w.Code)
+    }
+}
+
+func TestVerifySignatureMiddleware_MustFail(t *testing.T) {
+    handler := VerifySignatureMiddlewareWithConfig(
+        &SignatureConfig{
+            Key:                     testSignatureKey,
+            Window:                  time.Minute,
+            RequireReplayProtection: true,
+        },
+    )(okHandler())
+    body := []byte("{\"name\": \"truck\"}")
+
+    expired := newSignedRequestV2(t, body, time.Now().Add(-2*time.Minute), "nonce-1")
+
+    legacy := httptest.NewRequest(http.MethodPost, "/vehicles", bytes.NewReader(body))
+    signature, err := GenerateSignature(legacy.Method, legacy.URL.Path, url.Values{}, body, testSignatureKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    legacy.Header.Set(XSignature, signature)
+
+    tampered := newSignedRequestV2(t, body, time.Now(), "nonce-2")
+    tampered.Header.Set(XSignatureNonce, "nonce-3")
+
+    tamperedHeader := newSignedRequestV2(t, body, time.Now(), "nonce-4")
+    tamperedHeader.Header.Set(ContentType, "text/plain")
+
+    for name, r := range map[string]*http.Request{
+        "expired":         expired,
+        "legacy":          legacy,
+        "tampered":        tampered,
+        "tampered header": tamperedHeader,
+    } {
+        w := httptest.NewRecorder()
+        handler.ServeHTTP(w, r)
+        if w.Code != http.StatusBadRequest {
+            t.Fatalf("%s request should be rejected, got %d", name, w.Code)
+        }
+    }
+}
+
+func TestVerifySignatureMiddleware_MaxBodySize(t *testing.T) {
+    handler := VerifySignatureMiddlewareWithConfig(
+        &SignatureConfig{Key: testSignatureKey, MaxBodySize: 8},
+    )(okHandler())
+
+    body := []byte("{\"name\": \"truck\"}")
+    r := httptest.NewRequest(http.MethodPost, "/vehicles", bytes.NewReader(body))
+    if err := SignRequest(r, body, "", testSignatureKey, nil); err != nil {
+        t.Fatal(err)
+    }
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("Status should be 413, got %d", w.Code)
+    }
+
+    var response Response
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if response.Success || response.Message != ErrRequestBodyTooLarge.Error() {
+        t.Fatalf("Response should be the error envelope, got %+v", response)
+    }
+
+    // chunked bodies have no declared length, so the limit must be enforced while reading
+    r = httptest.NewRequest(http.MethodPost, "/vehicles", bytes.NewReader(body))
+    if err := SignRequest(r, body, "", testSignatureKey, nil); err != nil {
+        t.Fatal(err)
+    }
+    r.ContentLength = -1
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("Status should be 413, got %d", w.Code)
+    }
+}
+
+func TestVerifySignatureMiddleware_StreamBody(t *testing.T) {
+    body := []byte("{\"positions\": [1, 2, 3]}")
+    handler := VerifySignatureMiddlewareWithConfig(
+        &SignatureConfig{Key: testSignatureKey, StreamBody: true},
+    )(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                // the decoder stops at the end of the value, before the reader returns io.EOF
+                var positions struct {
+                    Positions []int `json:"positions"`
+                }
+                if err := json.NewDecoder(r.Body).Decode(&positions); err != nil {
+                    t.Errorf("Body should be decoded, got %v", err)
+                }
+                if len(positions.Positions) != 3 {
+                    t.Errorf("Body should be the signed body, got %+v", positions)
+                }
+                w.WriteHeader(http.StatusOK)
+            },
+        ),
+    )
+
+    signed := httptest.NewRequest(http.MethodPost, "/positions", bytes.NewReader(body))
+    if err := SignRequest(signed, body, "", testSignatureKey, nil); err != nil {
+        t.Fatal(err)
+    }
+
+    // the signature and declared digest are valid, but the body was swapped in transit
+    r := httptest.NewRequest(http.MethodPost, "/positions", bytes.NewReader([]byte("{\"positions\": []}")))
+    r.Header = signed.Header.Clone()
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Status should be 400, got %d", w.Code)
+    }
+    if response := decodeTestResponse(t, w); response.Success {
+        t.Fatalf("Response should be the error envelope, got %+v", response)
+    }
+
+    // the nonce of the rejected request must still be usable by the real one
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, signed)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", w.Code)
+    }
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+    type user struct {
+        ID string `json:"id"`
+    }
+
+    auth := VerifySignatureMiddlewareWithConfig(
+        &SignatureConfig{Key: testSignatureKey, RequireReplayProtection: true},
+    )(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                if r.Header.Get(Authorization) != "Bearer token" {
+                    w.WriteHeader(http.StatusUnauthorized)
+                    return
+                }
+                WriteJSON(w, http.StatusOK, &user{ID: "u-1"})
+            },
+        ),
+    )
+    server := httptest.NewServer(auth)
+    defer server.Close()
+
+    handler := AuthorizationMiddleware[user](server.URL+"/auth/verify", testSignatureKey)(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                if u, ok := r.Context().Value(UserContextKey).(*user); !ok || u.ID != "u-1" {
+                    t.Errorf("User should be set in the context, got %v", r.Context().Value(UserContextKey))
+                }
+                w.WriteHeader(http.StatusOK)
+            },
+        ),
+    )
+
+    r := httptest.NewRequest(http.MethodGet, "/vehicles", nil)
+    r.Header.Set(Authorization, "Bearer token")
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Auth service requiring replay protection should accept the call, got %d %s", w.Code, w.Body)
+    }
+}
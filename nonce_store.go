@@ -0,0 +1,53 @@
+package common
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// NonceStore remembers the nonces of signed requests so they can't be used twice
+type NonceStore interface {
+    // Use records the nonce until the ttl passes,
+    // it returns false if the nonce was already used
+    Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is an in-memory NonceStore, it is only safe for a single instance of a service,
+// replicated services should share a store like redis instead
+type MemoryNonceStore struct {
+    sync.Mutex
+
+    nonces    map[string]time.Time
+    lastSweep time.Time
+}
+
+// NewMemoryNonceStore creates a new MemoryNonceStore
+func NewMemoryNonceStore() *MemoryNonceStore {
+    return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Use implements NonceStore
+func (s *MemoryNonceStore) Use(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+    s.Lock()
+    defer s.Unlock()
+
+    now := time.Now()
+
+    // sweeping on every call would make every request pay for the whole map
+    if now.Sub(s.lastSweep) > ttl {
+        for n, expiresAt := range s.nonces {
+            if now.After(expiresAt) {
+                delete(s.nonces, n)
+            }
+        }
+        s.lastSweep = now
+    }
+
+    if expiresAt, ok := s.nonces[nonce]; ok && now.Before(expiresAt) {
+        return false, nil
+    }
+
+    s.nonces[nonce] = now.Add(ttl)
+    return true, nil
+}
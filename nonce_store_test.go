@@ -0,0 +1,48 @@
+package common
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestMemoryNonceStore_Use(t *testing.T) {
+    store := NewMemoryNonceStore()
+
+    fresh, err := store.Use(context.Background(), "nonce", time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !fresh {
+        t.Fatal("Nonce should be fresh")
+    }
+
+    fresh, err = store.Use(context.Background(), "nonce", time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fresh {
+        t.Fatal("Nonce should be rejected the second time")
+    }
+}
+
+func TestMemoryNonceStore_Expired(t *testing.T) {
+    store := NewMemoryNonceStore()
+
+    if _, err := store.Use(context.Background(), "nonce", time.Millisecond); err != nil {
+        t.Fatal(err)
+    }
+
+    time.Sleep(5 * time.Millisecond)
+
+    fresh, err := store.Use(context.Background(), "nonce", time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !fresh {
+        t.Fatal("Nonce should be fresh once it is expired")
+    }
+    if len(store.nonces) != 1 {
+        t.Fatalf("Expired nonces should be swept, got %d", len(store.nonces))
+    }
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+const (
+    QueryLimit  = "limit"
+    QueryOffset = "offset"
+    QueryCursor = "cursor"
+    QueryPage   = "page"
+    QuerySort   = "sort"
+)
+
+// PageMeta describes the page, offset pages have the offset and total, cursor pages have the cursors
+type PageMeta struct {
+    Limit      int    `json:"limit"`
+    Offset     *int   `json:"offset,omitempty"`
+    Total      *int64 `json:"total,omitempty"`
+    NextCursor string `json:"next_cursor,omitempty"`
+    PrevCursor string `json:"prev_cursor,omitempty"`
+    HasMore    bool   `json:"has_more"`
+}
+
+// PageLinks are the urls of the pages, relative to the host
+type PageLinks struct {
+    Self  string `json:"self"`
+    First string `json:"first,omitempty"`
+    Prev  string `json:"prev,omitempty"`
+    Next  string `json:"next,omitempty"`
+    Last  string `json:"last,omitempty"`
+}
+
+// PagedResponse is the Response envelope of a list, with the meta and links of the page
+type PagedResponse[T any] struct {
+    Success bool      `json:"success"`
+    Code    string    `json:"code,omitempty"`
+    Message string    `json:"message"`
+    Data    []T       `json:"data"`
+    Meta    PageMeta  `json:"meta"`
+    Links   PageLinks `json:"links"`
+    Error   any       `json:"error"`
+}
+
+// pageLink returns the url of the request with the params replaced, the other params like filters are kept
+func pageLink(r *http.Request, params map[string]string) string {
+    query := r.URL.Query()
+    for key, value := range params {
+        if value == "" {
+            query.Del(key)
+            continue
+        }
+        query.Set(key, value)
+    }
+    link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+    return link.String()
+}
+
+// NewOffsetPage creates the page of the items at the offset, total is the count of all items
+func NewOffsetPage[T any](r *http.Request, items []T, offset, limit int, total int64) *PagedResponse[T] {
+    // clients should get [] instead of null for an empty page
+    if items == nil {
+        items = []T{}
+    }
+
+    offsetLink := func(offset int) string {
+        return pageLink(
+            r, map[string]string{QueryOffset: strconv.Itoa(offset), QueryLimit: strconv.Itoa(limit), QueryPage: ""},
+        )
+    }
+
+    page := &PagedResponse[T]{
+        Success: true,
+        Data:    items,
+        Meta: PageMeta{
+            Limit:   limit,
+            Offset:  &offset,
+            Total:   &total,
+            HasMore: int64(offset+len(items)) < total,
+        },
+        Links: PageLinks{
+            Self:  offsetLink(offset),
+            First: offsetLink(0),
+        },
+    }
+
+    if limit > 0 {
+        if offset > 0 {
+            page.Links.Prev = offsetLink(max(offset-limit, 0))
+        }
+        if page.Meta.HasMore {
+            page.Links.Next = offsetLink(offset + limit)
+        }
+        if total > 0 {
+            page.Links.Last = offsetLink(int((total - 1) / int64(limit) * int64(limit)))
+        }
+    }
+    return page
+}
+
+// NewCursorPage creates the page of the items after the cursor of the request,
+// the cursors are empty if there is no page in their direction
+func NewCursorPage[T any](r *http.Request, items []T, limit int, nextCursor, prevCursor string) *PagedResponse[T] {
+    if items == nil {
+        items = []T{}
+    }
+
+    cursorLink := func(cursor string) string {
+        return pageLink(
+            r, map[string]string{QueryCursor: cursor, QueryLimit: strconv.Itoa(limit), QueryOffset: "", QueryPage: ""},
+        )
+    }
+
+    page := &PagedResponse[T]{
+        Success: true,
+        Data:    items,
+        Meta: PageMeta{
+            Limit:      limit,
+            NextCursor: nextCursor,
+            PrevCursor: prevCursor,
+            HasMore:    nextCursor != "",
+        },
+        Links: PageLinks{
+            Self:  cursorLink(r.URL.Query().Get(QueryCursor)),
+            First: cursorLink(""),
+        },
+    }
+    if prevCursor != "" {
+        page.Links.Prev = cursorLink(prevCursor)
+    }
+    if nextCursor != "" {
+        page.Links.Next = cursorLink(nextCursor)
+    }
+    return page
+}
+
+// WritePage writes the page with the Link header of its links and the X-Total-Count header of offset pages
+func WritePage[T any](w http.ResponseWriter, page *PagedResponse[T]) {
+    var links []string
+    for _, link := range []struct{ rel, url string }{
+        {"first", page.Links.First},
+        {"prev", page.Links.Prev},
+        {"next", page.Links.Next},
+        {"last", page.Links.Last},
+    } {
+        if link.url != "" {
+            links = append(links, "<"+link.url+">; rel=\""+link.rel+"\"")
+        }
+    }
+    if len(links) > 0 {
+        w.Header().Set("Link", strings.Join(links, ", "))
+    }
+    if page.Meta.Total != nil {
+        w.Header().Set(XTotalCount, strconv.FormatInt(*page.Meta.Total, 10))
+    }
+    WriteJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/goccy/go-json"
+)
+
+type testVehicle struct {
+    ID string `json:"id"`
+}
+
+func TestWriteResponse(t *testing.T) {
+    w := httptest.NewRecorder()
+    WriteResponse(w, http.StatusCreated, &testVehicle{ID: "v-1"}, "Vehicle created")
+
+    if w.Code != http.StatusCreated || w.Header().Get(ContentType) != ApplicationJSON {
+        t.Fatalf("Status and content type should be set, got %d %s", w.Code, w.Header().Get(ContentType))
+    }
+
+    var response TypedResponse[testVehicle]
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if !response.Success || response.Data.ID != "v-1" || response.Message != "Vehicle created" {
+        t.Fatalf("Data should be decoded in one pass, got %+v", response)
+    }
+}
+
+func TestNewOffsetPage(t *testing.T) {
+    r := httptest.NewRequest(http.MethodGet, "/vehicles?status=active&offset=20&limit=10", nil)
+    page := NewOffsetPage(r, []testVehicle{{ID: "v-21"}}, 20, 10, 45)
+
+    if !page.Meta.HasMore || *page.Meta.Offset != 20 || *page.Meta.Total != 45 {
+        t.Fatalf("Meta should describe the page, got %+v", page.Meta)
+    }
+
+    expected := PageLinks{
+        Self:  "/vehicles?limit=10&offset=20&status=active",
+        First: "/vehicles?limit=10&offset=0&status=active",
+        Prev:  "/vehicles?limit=10&offset=10&status=active",
+        Next:  "/vehicles?limit=10&offset=30&status=active",
+        Last:  "/vehicles?limit=10&offset=40&status=active",
+    }
+    if page.Links != expected {
+        t.Fatalf("Links should be %+v, got %+v", expected, page.Links)
+    }
+
+    w := httptest.NewRecorder()
+    WritePage(w, page)
+
+    if w.Header().Get(XTotalCount) != "45" {
+        t.Fatalf("Total count should be set, got %s", w.Header().Get(XTotalCount))
+    }
+    link := "</vehicles?limit=10&offset=0&status=active>; rel=\"first\", " +
+        "</vehicles?limit=10&offset=10&status=active>; rel=\"prev\", " +
+        "</vehicles?limit=10&offset=30&status=active>; rel=\"next\", " +
+        "</vehicles?limit=10&offset=40&status=active>; rel=\"last\""
+    if w.Header().Get("Link") != link {
+        t.Fatalf("Link header should be %s, got %s", link, w.Header().Get("Link"))
+    }
+
+    var response PagedResponse[testVehicle]
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if len(response.Data) != 1 || response.Data[0].ID != "v-21" || response.Links != expected {
+        t.Fatalf("Page should be decoded, got %+v", response)
+    }
+}
+
+func TestNewCursorPage(t *testing.T) {
+    r := httptest.NewRequest(http.MethodGet, "/positions?vehicle_id=v-1&cursor=abc&limit=2", nil)
+    page := NewCursorPage[testVehicle](r, nil, 2, "", "xyz")
+
+    if page.Meta.HasMore || page.Links.Next != "" {
+        t.Fatalf("Last page should have no next link, got %+v", page)
+    }
+    if page.Links.Prev != "/positions?cursor=xyz&limit=2&vehicle_id=v-1" {
+        t.Fatalf("Prev link should have the cursor, got %s", page.Links.Prev)
+    }
+
+    buf, err := json.Marshal(page)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var members map[string]any
+    if err := json.Unmarshal(buf, &members); err != nil {
+        t.Fatal(err)
+    }
+    if data, ok := members["data"].([]any); !ok || len(data) != 0 {
+        t.Fatalf("Empty pages should have an empty list, got %s", buf)
+    }
+}
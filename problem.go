@@ -0,0 +1,141 @@
+package common
+
+import (
+    "maps"
+    "mime"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/goccy/go-json"
+)
+
+const ApplicationProblemJSON = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 error document, served as application/problem+json
+type ProblemDetails struct {
+    // Type is a URI that identifies the problem, about:blank if it is only described by the status
+    Type     string `json:"type"`
+    Title    string `json:"title"`
+    Status   int    `json:"status"`
+    Detail   string `json:"detail,omitempty"`
+    Instance string `json:"instance,omitempty"`
+    // Code is the code of the AppError
+    Code string `json:"code,omitempty"`
+    // Errors are the messages of the fields that failed the validation, keyed like the Response error
+    Errors map[string]string `json:"errors,omitempty"`
+    // Extensions are additional members, they are written next to the standard members
+    Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON writes the extension members at the top level of the document, like the RFC requires
+func (p *ProblemDetails) MarshalJSON() ([]byte, error) {
+    type problemDetails ProblemDetails
+    buf, err := json.Marshal((*problemDetails)(p))
+    if err != nil || len(p.Extensions) == 0 {
+        return buf, err
+    }
+
+    members := make(map[string]any, len(p.Extensions))
+    for key, value := range p.Extensions {
+        members[key] = value
+    }
+    // the standard members always win over the extensions
+    var standard map[string]any
+    if err := json.Unmarshal(buf, &standard); err != nil {
+        return nil, err
+    }
+    for key, value := range standard {
+        members[key] = value
+    }
+    return json.Marshal(members)
+}
+
+// DefaultProblemDetails creates the problem details of the error, like DefaultErrorResponse does for the Response,
+// a zero status is derived from the error
+func DefaultProblemDetails(statusCode int, err error) *ProblemDetails {
+    return newProblemDetails(resolveAppError(statusCode, err), DefaultLocale)
+}
+
+func newProblemDetails(appErr *AppError, locale string) *ProblemDetails {
+    return &ProblemDetails{
+        Type:       "about:blank",
+        Title:      http.StatusText(appErr.Status),
+        Status:     appErr.Status,
+        Detail:     appErr.Message,
+        Code:       appErr.Code,
+        Errors:     validationErrorsFormat(appErr.Cause, locale),
+        Extensions: maps.Clone(appErr.Details),
+    }
+}
+
+// WantsProblemDetails checks if the client prefers application/problem+json over application/json,
+// clients that accept anything keep getting the Response envelope
+func WantsProblemDetails(r *http.Request) bool {
+    problemQuality, jsonQuality := -1.0, -1.0
+    for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+        mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+        if err != nil {
+            continue
+        }
+        quality := 1.0
+        if q, ok := params["q"]; ok {
+            if quality, err = strconv.ParseFloat(q, 64); err != nil {
+                continue
+            }
+        }
+        switch mediaType {
+        case ApplicationProblemJSON:
+            problemQuality = max(problemQuality, quality)
+        case ApplicationJSON:
+            jsonQuality = max(jsonQuality, quality)
+        }
+    }
+    return problemQuality > 0 && problemQuality >= jsonQuality
+}
+
+// errorResponseWriter carries what ErrorNegotiationMiddleware negotiated to HandleError
+type errorResponseWriter struct {
+    http.ResponseWriter
+    problem  bool
+    instance string
+    // locale of the validation messages
+    locale string
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *errorResponseWriter) Unwrap() http.ResponseWriter {
+    return w.ResponseWriter
+}
+
+// errorWriterOf finds the errorResponseWriter, even if other middlewares wrapped it again
+func errorWriterOf(w http.ResponseWriter) (*errorResponseWriter, bool) {
+    for {
+        switch writer := w.(type) {
+        case *errorResponseWriter:
+            return writer, true
+        case interface{ Unwrap() http.ResponseWriter }:
+            w = writer.Unwrap()
+        default:
+            return nil, false
+        }
+    }
+}
+
+// ErrorNegotiationMiddleware lets HandleError write problem details instead of the Response envelope
+// to the clients that ask for application/problem+json in the Accept header,
+// and the validation messages in the locale of the Accept-Language header
+func ErrorNegotiationMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            next.ServeHTTP(
+                &errorResponseWriter{
+                    ResponseWriter: w,
+                    problem:        WantsProblemDetails(r),
+                    instance:       r.URL.Path,
+                    locale:         LocaleFromRequest(r),
+                }, r,
+            )
+        },
+    )
+}
@@ -0,0 +1,108 @@
+package common
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/go-playground/validator/v10"
+    "github.com/goccy/go-json"
+)
+
+type problemTestRequest struct {
+    Email string `validate:"required,email"`
+}
+
+func errorHandler(err error) http.Handler {
+    return http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set(ContentType, ApplicationJSON)
+            HandleError(http.StatusBadRequest, w, err)
+        },
+    )
+}
+
+func TestWantsProblemDetails(t *testing.T) {
+    tests := map[string]bool{
+        "":                         false,
+        "*/*":                      false,
+        "application/json":         false,
+        "application/problem+json": true,
+        "application/problem+json, application/json":       true,
+        "application/problem+json;q=0.5, application/json": false,
+        "application/problem+json;q=0":                     false,
+    }
+
+    for accept, expected := range tests {
+        r := httptest.NewRequest(http.MethodGet, "/", nil)
+        r.Header.Set("Accept", accept)
+        if WantsProblemDetails(r) != expected {
+            t.Errorf("Accept %q should want problem details: %v", accept, expected)
+        }
+    }
+}
+
+func TestErrorNegotiationMiddleware(t *testing.T) {
+    err := validator.New().Struct(&problemTestRequest{Email: "invalid"})
+
+    r := httptest.NewRequest(http.MethodPost, "/drivers", nil)
+    r.Header.Set("Accept", ApplicationProblemJSON)
+    w := httptest.NewRecorder()
+    ErrorNegotiationMiddleware(errorHandler(err)).ServeHTTP(w, r)
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Status should be 400, got %d", w.Code)
+    }
+    if w.Header().Get(ContentType) != ApplicationProblemJSON {
+        t.Fatalf("Content type should be %s, got %s", ApplicationProblemJSON, w.Header().Get(ContentType))
+    }
+
+    var problem ProblemDetails
+    if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+        t.Fatal(err)
+    }
+    if problem.Type != "about:blank" || problem.Title != "Bad Request" || problem.Status != http.StatusBadRequest {
+        t.Fatalf("Problem should describe the status, got %+v", problem)
+    }
+    if problem.Instance != "/drivers" {
+        t.Fatalf("Instance should be the path, got %s", problem.Instance)
+    }
+    if problem.Errors["email"] != "Invalid email" {
+        t.Fatalf("Validation errors should be an extension member, got %v", problem.Errors)
+    }
+
+    // clients that don't ask for problem details keep getting the envelope
+    r.Header.Set("Accept", ApplicationJSON)
+    w = httptest.NewRecorder()
+    ErrorNegotiationMiddleware(errorHandler(err)).ServeHTTP(w, r)
+
+    var response Response
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if response.Success || w.Header().Get(ContentType) != ApplicationJSON {
+        t.Fatalf("Response envelope should be written, got %s", w.Body.String())
+    }
+}
+
+func TestProblemDetails_MarshalJSON(t *testing.T) {
+    problem := DefaultProblemDetails(http.StatusConflict, errors.New("vehicle already exists"))
+    problem.Extensions = map[string]any{"vehicle_id": "v-1", "status": "ignored"}
+
+    buf, err := json.Marshal(problem)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var members map[string]any
+    if err := json.Unmarshal(buf, &members); err != nil {
+        t.Fatal(err)
+    }
+    if members["vehicle_id"] != "v-1" {
+        t.Fatalf("Extensions should be top level members, got %s", buf)
+    }
+    if members["status"] != float64(http.StatusConflict) {
+        t.Fatalf("Standard members should win over extensions, got %s", buf)
+    }
+}
@@ -1,6 +1,9 @@
 package common
 
 import (
+    "context"
+    "crypto/tls"
+    "log"
     "sync"
 
     amqp "github.com/rabbitmq/amqp091-go"
@@ -11,9 +14,10 @@ import (
 type RabbitConnection struct {
     sync.Mutex
 
-    connStr string
-    conn    *amqp.Connection
-    channel *amqp.Channel
+    connStr   string
+    tlsConfig *tls.Config
+    conn      *amqp.Connection
+    channel   *amqp.Channel
 }
 
 // NewRabbitConnection creates a new RabbitConnection
@@ -21,6 +25,12 @@ func NewRabbitConnection(connStr string) *RabbitConnection {
     return &RabbitConnection{connStr: connStr}
 }
 
+// NewRabbitConnectionWithTLS creates a new RabbitConnection that connects over amqps
+// and presents the client certificate of the tls config
+func NewRabbitConnectionWithTLS(connStr string, tlsConfig *tls.Config) *RabbitConnection {
+    return &RabbitConnection{connStr: connStr, tlsConfig: tlsConfig}
+}
+
 // connect establishes a new connection to RabbitMQ
 func (a *RabbitConnection) connect() error {
     a.Lock()
@@ -32,6 +42,10 @@ func (a *RabbitConnection) connect() error {
     }
 
     a.conn = nil
+    if a.tlsConfig != nil {
+        a.conn, err = amqp.DialTLS(a.connStr, a.tlsConfig)
+        return err
+    }
     a.conn, err = amqp.Dial(a.connStr)
     return err
 }
@@ -57,6 +71,79 @@ func (a *RabbitConnection) Channel() (*amqp.Channel, error) {
     return a.channel, nil
 }
 
+// Publish publishes the message on the active channel,
+// the tenant of the context is propagated as the x-tenant-id header
+func (a *RabbitConnection) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+    channel, err := a.Channel()
+    if err != nil {
+        return err
+    }
+
+    msg.Headers = withTenantHeader(ctx, msg.Headers)
+
+    return channel.PublishWithContext(ctx, exchange, key, false, false, msg)
+}
+
+// DeliveryHandler handles a consumed message, the context carries the tenant of the message
+type DeliveryHandler func(ctx context.Context, delivery amqp.Delivery) error
+
+// Consume consumes the queue until the context is done or the channel is closed,
+// a message is acked if the handler succeeds, a failed message is requeued once and
+// rejected after that, so a poison message goes to the dead letter exchange instead of looping
+func (a *RabbitConnection) Consume(ctx context.Context, queue string, handler DeliveryHandler) error {
+    channel, err := a.Channel()
+    if err != nil {
+        return err
+    }
+
+    deliveries, err := channel.ConsumeWithContext(ctx, queue, "", false, false, false, false, nil)
+    if err != nil {
+        return err
+    }
+
+    for delivery := range deliveries {
+        if err := handler(ContextFromDelivery(ctx, delivery), delivery); err != nil {
+            log.Println("Failed to handle delivery", err)
+            if err := delivery.Nack(false, !delivery.Redelivered); err != nil {
+                log.Println("Failed to nack delivery", err)
+            }
+            continue
+        }
+        if err := delivery.Ack(false); err != nil {
+            log.Println("Failed to ack delivery", err)
+        }
+    }
+
+    return ctx.Err()
+}
+
+// ContextFromDelivery restores the tenant carried by the delivery headers into the context
+func ContextFromDelivery(ctx context.Context, delivery amqp.Delivery) context.Context {
+    tenantID, ok := delivery.Headers[AmqpTenantHeader].(string)
+    if !ok || tenantID == "" {
+        return ctx
+    }
+    return WithTenant(ctx, tenantID)
+}
+
+// withTenantHeader copies the headers and adds the tenant of the context,
+// we copy so the caller's table is not mutated when it is reused
+func withTenantHeader(ctx context.Context, headers amqp.Table) amqp.Table {
+    tenantID, ok := TenantFromContext(ctx)
+    if !ok {
+        return headers
+    }
+    table := make(amqp.Table, len(headers)+1)
+    for k, v := range headers {
+        table[k] = v
+    }
+    // an explicitly set header always wins
+    if _, exists := table[AmqpTenantHeader]; !exists {
+        table[AmqpTenantHeader] = tenantID
+    }
+    return table
+}
+
 // Close shuts down the RabbitMQ connection and channel gracefully
 func (a *RabbitConnection) Close() error {
     var wg sync.WaitGroup
@@ -2,13 +2,18 @@ package common
 
 import (
     "errors"
-    "strings"
+    "log"
+    "maps"
+    "net/http"
+    "reflect"
 
     "github.com/go-playground/validator/v10"
+    "github.com/goccy/go-json"
 )
 
 type Response struct {
     Success bool        `json:"success"`
+    Code    string      `json:"code,omitempty"`
     Message string      `json:"message"`
     Data    interface{} `json:"data"`
     Error   interface{} `json:"error"`
@@ -23,38 +28,131 @@ func DefaultSuccessResponse(data any, message string) *Response {
     }
 }
 
+// TypedResponse is the Response envelope with typed data, so clients decode the data in one pass,
+// it is written and read the same way as Response
+type TypedResponse[T any] struct {
+    Success bool   `json:"success"`
+    Code    string `json:"code,omitempty"`
+    Message string `json:"message"`
+    Data    T      `json:"data"`
+    Error   any    `json:"error"`
+}
+
+// NewTypedResponse creates a successful typed response, like DefaultSuccessResponse
+func NewTypedResponse[T any](data T, message string) *TypedResponse[T] {
+    return &TypedResponse[T]{
+        Success: true,
+        Message: message,
+        Data:    data,
+    }
+}
+
+// WriteJSON writes the value as json with the status
+func WriteJSON(w http.ResponseWriter, statusCode int, value any) {
+    w.Header().Set(ContentType, ApplicationJSON)
+    w.WriteHeader(statusCode)
+    if err := json.NewEncoder(w).Encode(value); err != nil {
+        log.Println("Failed to encode response", err)
+    }
+}
+
+// WriteResponse writes a successful typed response with the status, like so:
+// WriteResponse(w, http.StatusCreated, vehicle, "Vehicle created")
+func WriteResponse[T any](w http.ResponseWriter, statusCode int, data T, message string) {
+    WriteJSON(w, statusCode, NewTypedResponse(data, message))
+}
+
+// FormatValidationMessage returns the English message of the tag without a param,
+// the tags whose message needs the param are "Invalid value", see FormatValidationMessageWithParam
 func FormatValidationMessage(tag string) string {
-    switch tag {
-    case "required":
-        return "This field is required"
-    case "email":
-        return "Invalid email"
-    case "jwt":
-        return "Malformed jwt"
-    case "uuid":
-        return "Invalid uuid format"
-    case "bool":
-        return "Invalid boolean value"
+    return FormatValidationMessageWithParam(tag, "", DefaultLocale)
+}
+
+// FormatValidationMessageWithParam returns the message of the tag with its param in the locale, like so:
+// FormatValidationMessageWithParam("min", "3", "en") is "This field must be 3 or greater",
+// the kind of the field is not known, so the params are compared as numbers,
+// use TranslateValidationError for the message of a field error
+func FormatValidationMessageWithParam(tag, param, locale string) string {
+    validationTranslator.RLock()
+    defer validationTranslator.RUnlock()
+
+    fallback := validationTranslator.GetFallback()
+    if trans, found := validationTranslator.GetTranslator(locale); found && trans != fallback {
+        if message, ok := translateValidation(trans, tag, param, reflect.Invalid, nil); ok {
+            return message
+        }
+        if message, ok := translateFormat(trans, tag); ok {
+            return message
+        }
+    }
+
+    // the custom messages win, then the messages before the translations and the formats
+    if message, ok := translateValidation(fallback, tag, param, reflect.Invalid, nil); ok {
+        return message
+    }
+    tags := []string{tag}
+    if alias, ok := validationTagAliases[tag]; ok {
+        tags = append(tags, alias)
+    }
+    for _, tag := range tags {
+        if message, ok := formatValidationMessages[tag]; ok {
+            return message
+        }
+    }
+    if message, ok := translateFormat(fallback, tag); ok {
+        return message
     }
 
-    return ""
+    defaultValidationTranslator.RLock()
+    defer defaultValidationTranslator.RUnlock()
+    for _, key := range []string{tag + "-number", tag} {
+        if message, ok := translateKey(defaultValidationTranslator.defaultTranslator, key, "This field", param); ok {
+            return message
+        }
+    }
+    message, _ := fallback.T("unknown")
+    return message
 }
 
+// DefaultErrorResponse creates the response of the error, only the safe message of the AppError is sent,
+// unknown errors are internal errors, see MapError
 func DefaultErrorResponse(err error) *Response {
+    return newErrorResponse(MapError(err), DefaultLocale)
+}
+
+func newErrorResponse(appErr *AppError, locale string) *Response {
     response := &Response{
         Success: false,
-        Message: err.Error(),
+        Code:    appErr.Code,
+        Message: appErr.Message,
         Data:    nil,
     }
-    var validationErrors validator.ValidationErrors
 
-    customErrorsFormat := make(map[string]string)
-    if errors.As(err, &validationErrors) {
-        for _, field := range validationErrors {
-            customErrorsFormat[strings.ToLower(field.Field())] = FormatValidationMessage(field.Tag())
-        }
+    if customErrorsFormat := validationErrorsFormat(appErr.Cause, locale); customErrorsFormat != nil {
         response.Error = customErrorsFormat
+    } else if len(appErr.Details) > 0 {
+        response.Error = appErr.Details
     }
 
     return response
 }
+
+// validationErrorsFormat returns the messages of the fields that failed the validation in the locale,
+// the FieldErrors are already formatted, nil for other errors
+func validationErrorsFormat(err error, locale string) map[string]string {
+    var fieldErrors FieldErrors
+    if errors.As(err, &fieldErrors) {
+        return maps.Clone(fieldErrors)
+    }
+
+    var validationErrors validator.ValidationErrors
+    if !errors.As(err, &validationErrors) {
+        return nil
+    }
+
+    customErrorsFormat := make(map[string]string)
+    for _, field := range validationErrors {
+        customErrorsFormat[validationErrorKey(field)] = TranslateValidationError(field, locale)
+    }
+    return customErrorsFormat
+}
@@ -0,0 +1,304 @@
+package common
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/goccy/go-json"
+)
+
+var ErrInvalidBaseURL = errors.New("invalid base url")
+
+const (
+    defaultServiceAttempts = 3
+    maxServiceResponseSize = 10 << 20
+)
+
+// ResponseError is the failed Response of another service
+type ResponseError struct {
+    StatusCode int
+    Code       string
+    Message    string
+    // Errors are the messages of the fields that failed the validation
+    Errors map[string]string
+    // Details is the error member of the response if it is not a validation error
+    Details any
+}
+
+func (e *ResponseError) Error() string {
+    if e.Code != "" {
+        return fmt.Sprintf("service responded %d %s: %s", e.StatusCode, e.Code, e.Message)
+    }
+    return fmt.Sprintf("service responded %d: %s", e.StatusCode, e.Message)
+}
+
+// Is matches the app errors by their code, like so: errors.Is(err, ErrNotFound)
+func (e *ResponseError) Is(target error) bool {
+    var appErr *AppError
+    return e.Code != "" && errors.As(target, &appErr) && appErr.Code == e.Code
+}
+
+// ServiceClientConfig configures the client of a service
+type ServiceClientConfig struct {
+    // BaseURL is the url of the service the paths are joined to, like http://vehicle-service/api/v1
+    BaseURL string
+    // Client sends the requests, HttpClient by default, which forwards the tenant of the context
+    Client *http.Client
+    // KeyID and SigningKey sign the requests, they are not signed if the key is empty
+    KeyID         string
+    SigningKey    string
+    SignedHeaders []string
+    // MaxAttempts of the idempotent requests, 3 by default, the others are sent once
+    MaxAttempts int
+    // Backoff returns the wait before the next attempt, ExponentialBackoff by default
+    Backoff func(attempt int) time.Duration
+    // Header is added to every request
+    Header http.Header
+}
+
+// ServiceClient calls another service and decodes its Response envelope, see Call
+type ServiceClient struct {
+    config  ServiceClientConfig
+    baseURL *url.URL
+    client  *http.Client
+}
+
+// NewServiceClient creates the client of a service, like so:
+// NewServiceClient(&ServiceClientConfig{BaseURL: "http://vehicle-service/api/v1", SigningKey: key}),
+// a nil config is the defaults, which have no base url, so it fails with ErrInvalidBaseURL
+func NewServiceClient(config *ServiceClientConfig) (*ServiceClient, error) {
+    if config == nil {
+        config = &ServiceClientConfig{}
+    }
+    clientConfig := *config
+    if clientConfig.Client == nil {
+        clientConfig.Client = HttpClient
+    }
+    if clientConfig.MaxAttempts <= 0 {
+        clientConfig.MaxAttempts = defaultServiceAttempts
+    }
+    if clientConfig.Backoff == nil {
+        clientConfig.Backoff = ExponentialBackoff
+    }
+
+    baseURL, err := url.Parse(clientConfig.BaseURL)
+    if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+        return nil, fmt.Errorf("%w: %q", ErrInvalidBaseURL, clientConfig.BaseURL)
+    }
+
+    client := clientConfig.Client
+    if clientConfig.SigningKey != "" {
+        client = WithSigningTransport(
+            client, &SigningTransport{
+                KeyID:         clientConfig.KeyID,
+                Key:           clientConfig.SigningKey,
+                SignedHeaders: append([]string{ContentType}, clientConfig.SignedHeaders...),
+            },
+        )
+    }
+
+    return &ServiceClient{
+        config:  clientConfig,
+        baseURL: baseURL,
+        client:  client,
+    }, nil
+}
+
+// resolve joins the path to the base url, the query of the path is kept
+func (c *ServiceClient) resolve(path string) (string, error) {
+    ref, err := url.Parse(path)
+    if err != nil {
+        return "", err
+    }
+    resolved := c.baseURL.JoinPath(ref.Path)
+    resolved.RawQuery = ref.RawQuery
+    return resolved.String(), nil
+}
+
+// isIdempotent checks if sending the request again has the same effect, only those are retried
+func isIdempotent(method string) bool {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+        return true
+    }
+    return false
+}
+
+// do sends the request with retries and returns the status and the body of the response
+func (c *ServiceClient) do(ctx context.Context, method, path string, body any) (int, []byte, error) {
+    target, err := c.resolve(path)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    var payload []byte
+    if body != nil {
+        if payload, err = json.Marshal(body); err != nil {
+            return 0, nil, err
+        }
+    }
+
+    attempts := 1
+    if isIdempotent(method) {
+        attempts = c.config.MaxAttempts
+    }
+
+    for attempt := 1; ; attempt++ {
+        statusCode, response, err := c.send(ctx, method, target, payload)
+        retry := err != nil || statusCode == http.StatusTooManyRequests ||
+            statusCode == http.StatusBadGateway ||
+            statusCode == http.StatusServiceUnavailable ||
+            statusCode == http.StatusGatewayTimeout
+        // the error of the context is final, the caller gave up
+        if !retry || attempt >= attempts || ctx.Err() != nil {
+            return statusCode, response, err
+        }
+
+        timer := time.NewTimer(c.config.Backoff(attempt))
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return 0, nil, ctx.Err()
+        }
+    }
+}
+
+// send makes a single attempt, the request is built again so it is signed again
+func (c *ServiceClient) send(ctx context.Context, method, target string, payload []byte) (int, []byte, error) {
+    var body io.Reader
+    if payload != nil {
+        body = bytes.NewReader(payload)
+    }
+
+    request, err := http.NewRequestWithContext(ctx, method, target, body)
+    if err != nil {
+        return 0, nil, err
+    }
+    // the values are added one by one, so the keys are canonical and the config is not shared
+    for key, values := range c.config.Header {
+        for _, value := range values {
+            request.Header.Add(key, value)
+        }
+    }
+    request.Header.Set("Accept", ApplicationJSON)
+    if payload != nil {
+        request.Header.Set(ContentType, ApplicationJSON)
+    }
+
+    res, err := c.client.Do(request)
+    if err != nil {
+        return 0, nil, err
+    }
+    defer func(Body io.ReadCloser) {
+        if err := Body.Close(); err != nil {
+            log.Println("Error closing response body", err)
+        }
+    }(res.Body)
+
+    response, err := io.ReadAll(io.LimitReader(res.Body, maxServiceResponseSize))
+    if err != nil {
+        return 0, nil, err
+    }
+    return res.StatusCode, response, nil
+}
+
+// newResponseError creates the error of a failed response from its envelope
+func newResponseError(statusCode int, code, message string, errorMember any) *ResponseError {
+    responseErr := &ResponseError{
+        StatusCode: statusCode,
+        Code:       code,
+        Message:    message,
+    }
+    if message == "" {
+        responseErr.Message = http.StatusText(statusCode)
+    }
+
+    // the validation errors are a map of messages, anything else is kept as details
+    if members, ok := errorMember.(map[string]any); ok {
+        messages := make(map[string]string, len(members))
+        for key, value := range members {
+            text, ok := value.(string)
+            if !ok {
+                messages = nil
+                break
+            }
+            messages[key] = text
+        }
+        if messages != nil {
+            responseErr.Errors = messages
+            return responseErr
+        }
+    }
+    responseErr.Details = errorMember
+    return responseErr
+}
+
+// decodeResponse decodes the envelope of the response, a failed response is a ResponseError
+func decodeResponse[E any](
+    statusCode int,
+    body []byte,
+    envelope *E,
+    success func(*E) (bool, string, string, any),
+) error {
+    if err := json.Unmarshal(body, envelope); err != nil {
+        // proxies answer errors with html, the status is all we know then
+        if statusCode >= http.StatusBadRequest {
+            return newResponseError(statusCode, "", "", nil)
+        }
+        return err
+    }
+
+    ok, code, message, errorMember := success(envelope)
+    if !ok || statusCode >= http.StatusBadRequest {
+        return newResponseError(statusCode, code, message, errorMember)
+    }
+    return nil
+}
+
+// Call sends the body as json and decodes the data of the Response envelope into T, like so:
+// vehicle, err := Call[Vehicle](ctx, vehicles, http.MethodGet, "/vehicles/"+id, nil)
+// a failed response is returned as ResponseError
+func Call[T any](ctx context.Context, c *ServiceClient, method, path string, body any) (*T, error) {
+    statusCode, response, err := c.do(ctx, method, path, body)
+    if err != nil {
+        return nil, err
+    }
+
+    var envelope TypedResponse[T]
+    err = decodeResponse(
+        statusCode, response, &envelope, func(e *TypedResponse[T]) (bool, string, string, any) {
+            return e.Success, e.Code, e.Message, e.Error
+        },
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &envelope.Data, nil
+}
+
+// CallPage sends the request and decodes the PagedResponse of a list endpoint
+func CallPage[T any](ctx context.Context, c *ServiceClient, method, path string, body any) (*PagedResponse[T], error) {
+    statusCode, response, err := c.do(ctx, method, path, body)
+    if err != nil {
+        return nil, err
+    }
+
+    var page PagedResponse[T]
+    err = decodeResponse(
+        statusCode, response, &page, func(p *PagedResponse[T]) (bool, string, string, any) {
+            return p.Success, p.Code, p.Message, p.Error
+        },
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &page, nil
+}
@@ -0,0 +1,188 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+)
+
+type createTestVehicleRequest struct {
+    Plate string `json:"plate" validate:"required"`
+}
+
+func newTestServiceClient(t *testing.T, handler http.Handler, signingKey string) *ServiceClient {
+    server := httptest.NewServer(handler)
+    t.Cleanup(server.Close)
+
+    client, err := NewServiceClient(
+        &ServiceClientConfig{
+            BaseURL:    server.URL + "/api/v1",
+            Client:     server.Client(),
+            SigningKey: signingKey,
+            Backoff:    noBackoff,
+        },
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    return client
+}
+
+func TestCall(t *testing.T) {
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            if r.URL.Path != "/api/v1/vehicles/v-1" || r.URL.Query().Get("expand") != "driver" {
+                t.Errorf("Path should be joined to the base url, got %s", r.URL)
+            }
+            WriteResponse(w, http.StatusOK, &testVehicle{ID: "v-1"}, "")
+        },
+    )
+    client := newTestServiceClient(t, handler, "")
+
+    vehicle, err := Call[testVehicle](context.Background(), client, http.MethodGet, "/vehicles/v-1?expand=driver", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if vehicle.ID != "v-1" {
+        t.Fatalf("Data should be decoded, got %+v", vehicle)
+    }
+}
+
+func TestCall_Header(t *testing.T) {
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            if r.Header.Get("X-Request-Source") != "fleet" || len(r.Header.Values("X-Trace")) != 2 {
+                t.Errorf("Header of the config should be added, got %v", r.Header)
+            }
+            WriteResponse(w, http.StatusOK, &testVehicle{ID: "v-1"}, "")
+        },
+    )
+    server := httptest.NewServer(handler)
+    defer server.Close()
+
+    header := http.Header{"x-request-source": {"fleet"}, "X-Trace": {"a", "b"}}
+    client, err := NewServiceClient(&ServiceClientConfig{BaseURL: server.URL, Client: server.Client(), Header: header})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := Call[testVehicle](context.Background(), client, http.MethodGet, "/vehicles/v-1", nil); err != nil {
+        t.Fatal(err)
+    }
+    if len(header["X-Trace"]) != 2 {
+        t.Fatal("Header of the config should not change")
+    }
+}
+
+func TestCall_Signed(t *testing.T) {
+    handler := VerifySignatureMiddleware(testSignatureKey)(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                request, ok := BindJSON[createTestVehicleRequest](w, r)
+                if !ok {
+                    return
+                }
+                WriteResponse(w, http.StatusCreated, &testVehicle{ID: request.Plate}, "")
+            },
+        ),
+    )
+    client := newTestServiceClient(t, handler, testSignatureKey)
+
+    vehicle, err := Call[testVehicle](
+        context.Background(), client, http.MethodPost, "/vehicles", &createTestVehicleRequest{Plate: "1A-2345"},
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    if vehicle.ID != "1A-2345" {
+        t.Fatalf("Signed request should be accepted, got %+v", vehicle)
+    }
+}
+
+func TestCall_ValidationError(t *testing.T) {
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            BindJSON[createTestVehicleRequest](w, r)
+        },
+    )
+    client := newTestServiceClient(t, handler, "")
+
+    _, err := Call[testVehicle](context.Background(), client, http.MethodPost, "/vehicles", &createTestVehicleRequest{})
+
+    var responseErr *ResponseError
+    if !errors.As(err, &responseErr) {
+        t.Fatalf("Error should be a ResponseError, got %v", err)
+    }
+    if responseErr.StatusCode != http.StatusBadRequest || responseErr.Errors["plate"] == "" {
+        t.Fatalf("Validation errors should be decoded, got %+v", responseErr)
+    }
+}
+
+func TestCall_AppError(t *testing.T) {
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            WriteError(w, ErrNotFound)
+        },
+    )
+    client := newTestServiceClient(t, handler, "")
+
+    _, err := Call[testVehicle](context.Background(), client, http.MethodGet, "/vehicles/v-2", nil)
+    if !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Error should match the app error by its code, got %v", err)
+    }
+}
+
+func TestCall_Retry(t *testing.T) {
+    var attempts atomic.Int32
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            if attempts.Add(1) < 3 {
+                w.WriteHeader(http.StatusServiceUnavailable)
+                return
+            }
+            WriteResponse(w, http.StatusOK, &testVehicle{ID: "v-1"}, "")
+        },
+    )
+    client := newTestServiceClient(t, handler, "")
+
+    if _, err := Call[testVehicle](context.Background(), client, http.MethodGet, "/vehicles/v-1", nil); err != nil {
+        t.Fatal(err)
+    }
+    if attempts.Load() != 3 {
+        t.Fatalf("Request should be retried until it succeeds, got %d attempts", attempts.Load())
+    }
+}
+
+func TestCall_Retry_MustFail(t *testing.T) {
+    var attempts atomic.Int32
+    handler := http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            attempts.Add(1)
+            w.WriteHeader(http.StatusServiceUnavailable)
+        },
+    )
+    client := newTestServiceClient(t, handler, "")
+
+    _, err := Call[testVehicle](context.Background(), client, http.MethodPost, "/vehicles", &testVehicle{})
+
+    var responseErr *ResponseError
+    if !errors.As(err, &responseErr) || responseErr.StatusCode != http.StatusServiceUnavailable {
+        t.Fatalf("Error should carry the status, got %v", err)
+    }
+    if attempts.Load() != 1 {
+        t.Fatalf("Non idempotent request should not be retried, got %d attempts", attempts.Load())
+    }
+}
+
+func TestNewServiceClient_MustFail(t *testing.T) {
+    _, err := NewServiceClient(&ServiceClientConfig{BaseURL: "vehicle-service"})
+    if !errors.Is(err, ErrInvalidBaseURL) {
+        t.Fatalf("Base url without scheme should fail, got %v", err)
+    }
+
+    if _, err := NewServiceClient(nil); !errors.Is(err, ErrInvalidBaseURL) {
+        t.Fatalf("Nil config has no base url and should fail, got %v", err)
+    }
+}
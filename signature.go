@@ -4,13 +4,25 @@ import (
     "crypto/hmac"
     "crypto/sha256"
     "encoding/hex"
+    "net/http"
     "net/url"
+    "slices"
     "sort"
+    "strconv"
     "strings"
+    "time"
 )
 
-// GenerateSignature generates a signature for the given parameters and body
-func GenerateSignature(method, path string, params url.Values, body []byte, secretKey string) (string, error) {
+const (
+    // SignatureV1 signs method, path, params and body, it is used when no version header is sent
+    SignatureV1 = "1"
+    // SignatureV2 signs the body digest, every parameter value, the signed headers
+    // and the timestamp and nonce of the request, so it can't be replayed
+    SignatureV2 = "2"
+)
+
+// canonicalV1 builds the string that is signed by the first signature version
+func canonicalV1(method, path string, params url.Values, body []byte) string {
     concatenatedString := strings.ToLower(method) + "&" + url.QueryEscape(path) + "&"
 
     // sort the parameters, if not sorted, the signature will be different
@@ -28,10 +40,117 @@ func GenerateSignature(method, path string, params url.Values, body []byte, secr
     // removing all spaces and new lines is important, otherwise the signature will be different
     concatenatedString += strings.ReplaceAll(strings.ReplaceAll(string(body), " ", ""), "\n", "")
 
-    // generate the signature
+    return concatenatedString
+}
+
+// sign generates the hex encoded hmac of the canonical string
+func sign(canonical, secretKey string) string {
     h := hmac.New(sha256.New, []byte(secretKey))
-    h.Write([]byte(concatenatedString))
-    signature := hex.EncodeToString(h.Sum(nil))
+    h.Write([]byte(canonical))
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// GenerateSignature generates a signature for the given parameters and body
+func GenerateSignature(method, path string, params url.Values, body []byte, secretKey string) (string, error) {
+    return sign(canonicalV1(method, path, params, body), secretKey), nil
+}
+
+// SignedRequest holds the parts of a request that a version 2 signature covers
+type SignedRequest struct {
+    Method string
+    Host   string
+    Path   string
+    Params url.Values
+    Header http.Header
+    // SignedHeaders are the header names sent in X-Signature-Headers,
+    // the timestamp and nonce headers are always signed
+    SignedHeaders []string
+    // BodyDigest is the hex encoded sha256 of the body, see BodyDigest
+    BodyDigest string
+}
+
+// BodyDigest returns the hex encoded sha256 of the body, the body is signed as is
+func BodyDigest(body []byte) string {
+    sum := sha256.Sum256(body)
+    return hex.EncodeToString(sum[:])
+}
+
+// ParseSignedHeaders parses the X-Signature-Headers header, like so: "content-type;x-tenant-id"
+func ParseSignedHeaders(value string) []string {
+    var headers []string
+    for _, name := range strings.Split(value, ";") {
+        if name = strings.TrimSpace(name); name != "" {
+            headers = append(headers, name)
+        }
+    }
+    return headers
+}
+
+// signedHeaderNames returns the lower cased, sorted and unique header names including the mandatory ones
+func signedHeaderNames(headers []string) []string {
+    names := []string{strings.ToLower(XSignatureTimestamp), strings.ToLower(XSignatureNonce)}
+    for _, name := range headers {
+        names = append(names, strings.ToLower(name))
+    }
+    sort.Strings(names)
+    return slices.Compact(names)
+}
+
+// Canonical builds the string that is signed by the second signature version,
+// every part is on its own line so no part can bleed into another one
+func (s *SignedRequest) Canonical() string {
+    var builder strings.Builder
+
+    builder.WriteString(strings.ToUpper(s.Method) + "\n")
+    builder.WriteString(url.PathEscape(s.Path) + "\n")
+
+    // every value of a repeated parameter is signed, sorted so the order doesn't matter
+    keys := make([]string, 0, len(s.Params))
+    for k := range s.Params {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    pairs := make([]string, 0, len(keys))
+    for _, k := range keys {
+        values := slices.Clone(s.Params[k])
+        sort.Strings(values)
+        for _, v := range values {
+            pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+        }
+    }
+    builder.WriteString(strings.Join(pairs, "&") + "\n")
+
+    names := signedHeaderNames(s.SignedHeaders)
+    for _, name := range names {
+        value := s.Host
+        if name != "host" {
+            values := slices.Clone(s.Header.Values(name))
+            for i := range values {
+                values[i] = strings.TrimSpace(values[i])
+            }
+            value = strings.Join(values, ",")
+        }
+        builder.WriteString(name + ":" + value + "\n")
+    }
+    builder.WriteString(strings.Join(names, ";") + "\n")
+
+    builder.WriteString(s.BodyDigest)
+
+    return builder.String()
+}
+
+// GenerateSignatureV2 generates a version 2 signature of the request,
+// unlike version 1 it doesn't strip the body and covers the timestamp, nonce and signed headers
+func GenerateSignatureV2(request *SignedRequest, secretKey string) (string, error) {
+    return sign(request.Canonical(), secretKey), nil
+}
+
+// SignatureTimestamp formats the time for the X-Signature-Timestamp header
+func SignatureTimestamp(t time.Time) string {
+    return strconv.FormatInt(t.Unix(), 10)
+}
 
-    return signature, nil
+// NewSignatureNonce generates a random nonce for the X-Signature-Nonce header
+func NewSignatureNonce() (string, error) {
+    return randomHex(16)
 }
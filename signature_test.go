@@ -79,3 +79,109 @@ func TestGenerateSignature(t *testing.T) {
         t.Errorf("Signatures are not equal")
     }
 }
+
+func newTestSignedRequest(params url.Values, body []byte, nonce string) *SignedRequest {
+    header := http.Header{}
+    header.Set(XSignatureTimestamp, "1700000000")
+    header.Set(XSignatureNonce, nonce)
+    header.Set(ContentType, ApplicationJSON)
+    return &SignedRequest{
+        Method:        method,
+        Path:          path,
+        Params:        params,
+        Header:        header,
+        SignedHeaders: []string{ContentType},
+        BodyDigest:    BodyDigest(body),
+    }
+}
+
+func TestGenerateSignatureV2(t *testing.T) {
+    params := url.Values{}
+    params.Add("key", "value")
+    body := []byte("{\"key\": \"value\"}")
+
+    signature1, err := GenerateSignatureV2(newTestSignedRequest(params, body, "nonce-1"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if signature1 == "" {
+        t.Errorf("Signature is empty")
+    }
+
+    signature2, err := GenerateSignatureV2(newTestSignedRequest(params, body, "nonce-2"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if signature1 == signature2 {
+        t.Errorf("Signatures with different nonces should not be equal")
+    }
+}
+
+func TestGenerateSignatureV2_Body(t *testing.T) {
+    params := url.Values{}
+
+    signature1, err := GenerateSignatureV2(newTestSignedRequest(params, []byte("{\"name\":\"Ko Ko\"}"), "nonce"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    signature2, err := GenerateSignatureV2(newTestSignedRequest(params, []byte("{\"name\":\"KoKo\"}"), "nonce"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if signature1 == signature2 {
+        t.Errorf("Signatures of different bodies should not be equal")
+    }
+}
+
+func TestGenerateSignatureV2_RepeatedParams(t *testing.T) {
+    params1 := url.Values{"status": {"active", "idle"}}
+    params2 := url.Values{"status": {"idle", "active"}}
+    params3 := url.Values{"status": {"active"}}
+
+    signature1, err := GenerateSignatureV2(newTestSignedRequest(params1, nil, "nonce"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    signature2, err := GenerateSignatureV2(newTestSignedRequest(params2, nil, "nonce"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    signature3, err := GenerateSignatureV2(newTestSignedRequest(params3, nil, "nonce"), secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if signature1 != signature2 {
+        t.Errorf("Order of repeated params should not matter")
+    }
+
+    if signature1 == signature3 {
+        t.Errorf("Every value of repeated params should be signed")
+    }
+}
+
+func TestGenerateSignatureV2_SignedHeaders(t *testing.T) {
+    request := newTestSignedRequest(url.Values{}, nil, "nonce")
+
+    signature1, err := GenerateSignatureV2(request, secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    request.Header.Set(ContentType, "text/plain")
+
+    signature2, err := GenerateSignatureV2(request, secretKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if signature1 == signature2 {
+        t.Errorf("Signed headers should be covered by the signature")
+    }
+}
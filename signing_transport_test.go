@@ -0,0 +1,91 @@
+package common
+
+import (
+    "bytes"
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestSigningTransport(t *testing.T) {
+    body := []byte("{\"name\": \"Ko Ko\"}")
+
+    server := httptest.NewServer(
+        VerifySignatureMiddleware(testSignatureKey)(
+            http.HandlerFunc(
+                func(w http.ResponseWriter, r *http.Request) {
+                    received, _ := r.Context().Value(Body).([]byte)
+                    if !bytes.Equal(received, body) {
+                        t.Errorf("Body should be %s, got %s", body, received)
+                    }
+                    if r.Header.Get(XTenantID) != "acme" {
+                        t.Errorf("Tenant should be forwarded")
+                    }
+                    w.WriteHeader(http.StatusOK)
+                },
+            ),
+        ),
+    )
+    defer server.Close()
+
+    client := NewSigningClient(HttpClient, testSignatureKey, "content-type", "x-tenant-id", "host")
+
+    r, err := http.NewRequestWithContext(
+        WithTenant(context.Background(), "acme"),
+        http.MethodPost,
+        server.URL+"/drivers?status=active&status=idle",
+        bytes.NewReader(body),
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    r.Header.Set(ContentType, ApplicationJSON)
+
+    res, err := client.Do(r)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", res.StatusCode)
+    }
+    if r.Header.Get(XSignature) != "" {
+        t.Fatal("Original request should not be modified")
+    }
+}
+
+func TestSigningTransport_EmptyPath(t *testing.T) {
+    server := httptest.NewServer(VerifySignatureMiddleware(testSignatureKey)(okHandler()))
+    defer server.Close()
+
+    client := NewSigningClient(HttpClient, testSignatureKey)
+
+    res, err := client.Post(server.URL, ApplicationJSON, bytes.NewReader([]byte("{}")))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", res.StatusCode)
+    }
+}
+
+func TestSigningTransport_MustFail(t *testing.T) {
+    server := httptest.NewServer(VerifySignatureMiddleware(testSignatureKey)(okHandler()))
+    defer server.Close()
+
+    client := NewSigningClient(HttpClient, "another-signature-key")
+
+    res, err := client.Post(server.URL, ApplicationJSON, bytes.NewReader([]byte("{}")))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusBadRequest {
+        t.Fatalf("Status should be 400, got %d", res.StatusCode)
+    }
+}
@@ -0,0 +1,164 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http"
+    "regexp"
+    "strings"
+)
+
+var (
+    ErrTenantRequired = errors.New("tenant is required")
+    ErrInvalidTenant  = errors.New("tenant is invalid")
+)
+
+// tenants end up in http and amqp headers, so we only allow a safe subset of characters
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// TenantPayload is a token payload that knows which tenant it was issued for
+type TenantPayload interface {
+    PayloadInterface
+    GetTenantID() string
+}
+
+// TenantExtractor finds the tenant of the request,
+// it returns an empty string if the request doesn't carry one
+type TenantExtractor func(r *http.Request) (string, error)
+
+// TenantFromHeader reads the tenant from the given header, X-Tenant-ID if empty
+func TenantFromHeader(header string) TenantExtractor {
+    if header == "" {
+        header = XTenantID
+    }
+    return func(r *http.Request) (string, error) {
+        return r.Header.Get(header), nil
+    }
+}
+
+// TenantFromSubdomain reads the tenant from the first label of the host,
+// like so: TenantFromSubdomain("fleet.example.com") resolves "acme.fleet.example.com" to "acme"
+func TenantFromSubdomain(baseDomain string) TenantExtractor {
+    suffix := "." + strings.TrimPrefix(strings.ToLower(baseDomain), ".")
+    return func(r *http.Request) (string, error) {
+        host := strings.ToLower(r.Host)
+        if h, _, err := net.SplitHostPort(host); err == nil {
+            host = h
+        }
+        if !strings.HasSuffix(host, suffix) {
+            return "", nil
+        }
+        subdomain := strings.TrimSuffix(host, suffix)
+        // only the label right before the base domain is the tenant
+        if i := strings.LastIndex(subdomain, "."); i >= 0 {
+            subdomain = subdomain[i+1:]
+        }
+        return subdomain, nil
+    }
+}
+
+// TenantFromToken reads the tenant from the claims of the bearer token,
+// newPayload must return a fresh payload for every call since the token is decoded into it
+func TenantFromToken(
+    maker TokenMaker,
+    secretKey string,
+    newPayload func() TenantPayload,
+) TenantExtractor {
+    return func(r *http.Request) (string, error) {
+        token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get(Authorization), "Bearer "))
+        if token == "" {
+            return "", nil
+        }
+        payload, err := maker.VerifyToken(token, secretKey, newPayload())
+        if err != nil {
+            return "", err
+        }
+        claims, ok := payload.(TenantPayload)
+        if !ok {
+            return "", ErrClaimsInvalid
+        }
+        return claims.GetTenantID(), nil
+    }
+}
+
+// WithTenant returns a copy of the context that carries the tenant
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+    return context.WithValue(ctx, TenantContextKey, tenantID)
+}
+
+// TenantFromContext returns the tenant stored by TenantMiddleware or WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+    tenantID, ok := ctx.Value(TenantContextKey).(string)
+    return tenantID, ok && tenantID != ""
+}
+
+// TenantMiddleware identifies the tenant of the request and sets it in the context,
+// the extractors are tried in order and the first non-empty tenant wins
+func TenantMiddleware(extractors ...TenantExtractor) func(http.Handler) http.Handler {
+    if len(extractors) == 0 {
+        extractors = []TenantExtractor{TenantFromHeader(XTenantID)}
+    }
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                var tenantID string
+                for _, extract := range extractors {
+                    id, err := extract(r)
+                    if err != nil {
+                        w.Header().Set(ContentType, ApplicationJSON)
+                        HandleError(http.StatusUnauthorized, w, err)
+                        return
+                    }
+                    if id != "" {
+                        tenantID = id
+                        break
+                    }
+                }
+
+                if tenantID == "" {
+                    w.Header().Set(ContentType, ApplicationJSON)
+                    HandleError(http.StatusBadRequest, w, ErrTenantRequired)
+                    return
+                }
+
+                if !tenantPattern.MatchString(tenantID) {
+                    w.Header().Set(ContentType, ApplicationJSON)
+                    HandleError(http.StatusBadRequest, w, ErrInvalidTenant)
+                    return
+                }
+
+                r = r.WithContext(WithTenant(r.Context(), tenantID))
+
+                next.ServeHTTP(w, r)
+            },
+        )
+    }
+}
+
+// TenantTransport is a http.RoundTripper that forwards the tenant
+// of the request context as the X-Tenant-ID header
+type TenantTransport struct {
+    // Base is the underlying transport, http.DefaultTransport if nil
+    Base http.RoundTripper
+}
+
+func (t *TenantTransport) base() http.RoundTripper {
+    if t.Base == nil {
+        return http.DefaultTransport
+    }
+    return t.Base
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *TenantTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+    tenantID, ok := TenantFromContext(r.Context())
+    // an explicitly set header always wins
+    if !ok || r.Header.Get(XTenantID) != "" {
+        return t.base().RoundTrip(r)
+    }
+    // a RoundTripper must not modify the original request
+    r = r.Clone(r.Context())
+    r.Header.Set(XTenantID, tenantID)
+    return t.base().RoundTrip(r)
+}
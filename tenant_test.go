@@ -0,0 +1,165 @@
+package common
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func tenantHandler(t *testing.T, expected string) http.Handler {
+    return http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            tenantID, ok := TenantFromContext(r.Context())
+            if !ok {
+                t.Error("Tenant should be in the context")
+            }
+            if tenantID != expected {
+                t.Errorf("Tenant should be %s, got %s", expected, tenantID)
+            }
+            w.WriteHeader(http.StatusOK)
+        },
+    )
+}
+
+func TestTenantMiddleware_Header(t *testing.T) {
+    handler := TenantMiddleware()(tenantHandler(t, "acme"))
+
+    r := httptest.NewRequest(http.MethodGet, "/", nil)
+    r.Header.Set(XTenantID, "acme")
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", w.Code)
+    }
+}
+
+func TestTenantMiddleware_Subdomain(t *testing.T) {
+    handler := TenantMiddleware(
+        TenantFromHeader(""),
+        TenantFromSubdomain("fleet.example.com"),
+    )(tenantHandler(t, "acme"))
+
+    r := httptest.NewRequest(http.MethodGet, "http://acme.fleet.example.com:8080/", nil)
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", w.Code)
+    }
+}
+
+func TestTenantMiddleware_MustFail(t *testing.T) {
+    handler := TenantMiddleware()(tenantHandler(t, ""))
+
+    r := httptest.NewRequest(http.MethodGet, "/", nil)
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Status should be 400, got %d", w.Code)
+    }
+
+    r = httptest.NewRequest(http.MethodGet, "/", nil)
+    r.Header.Set(XTenantID, "acme\r\nX-Injected: 1")
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Status should be 400, got %d", w.Code)
+    }
+}
+
+func TestTenantTransport(t *testing.T) {
+    server := httptest.NewServer(TenantMiddleware()(tenantHandler(t, "acme")))
+    defer server.Close()
+
+    r, err := http.NewRequestWithContext(WithTenant(context.Background(), "acme"), http.MethodGet, server.URL, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    res, err := HttpClient.Do(r)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", res.StatusCode)
+    }
+    if r.Header.Get(XTenantID) != "" {
+        t.Fatal("Original request should not be modified")
+    }
+}
+
+func TestTenantAmqpHeaders(t *testing.T) {
+    headers := amqp.Table{"key": "value"}
+    table := withTenantHeader(WithTenant(context.Background(), "acme"), headers)
+
+    if _, ok := headers[AmqpTenantHeader]; ok {
+        t.Fatal("Original headers should not be modified")
+    }
+
+    ctx := ContextFromDelivery(context.Background(), amqp.Delivery{Headers: table})
+    tenantID, ok := TenantFromContext(ctx)
+    if !ok || tenantID != "acme" {
+        t.Fatalf("Tenant should be restored from the delivery, got %s", tenantID)
+    }
+}
+
+const testTenantTokenKey = "test-tenant-token-key-of-32-bytes"
+
+type testTenantPayload struct {
+    TenantID string `json:"tenant_id"`
+}
+
+func (p *testTenantPayload) Valid() error {
+    return nil
+}
+
+func (p *testTenantPayload) GetTenantID() string {
+    return p.TenantID
+}
+
+func TestTenantFromToken(t *testing.T) {
+    maker := NewJwtMaker()
+    token, err := maker.CreateToken(&testTenantPayload{TenantID: "acme"}, testTenantTokenKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    extractor := TenantFromToken(
+        maker, testTenantTokenKey, func() TenantPayload {
+            return &testTenantPayload{}
+        },
+    )
+
+    r := httptest.NewRequest(http.MethodGet, "/", nil)
+    r.Header.Set(Authorization, "Bearer "+token)
+    tenantID, err := extractor(r)
+    if err != nil || tenantID != "acme" {
+        t.Fatalf("Tenant should be read from the token, got %s %v", tenantID, err)
+    }
+
+    r = httptest.NewRequest(http.MethodGet, "/", nil)
+    if tenantID, err := extractor(r); err != nil || tenantID != "" {
+        t.Fatalf("Request without a token should have no tenant, got %s %v", tenantID, err)
+    }
+}
+
+func TestTenantFromToken_MustFail(t *testing.T) {
+    extractor := TenantFromToken(
+        NewJwtMaker(), testTenantTokenKey, func() TenantPayload {
+            return &testTenantPayload{}
+        },
+    )
+
+    r := httptest.NewRequest(http.MethodGet, "/", nil)
+    r.Header.Set(Authorization, "Bearer not-a-token")
+    if _, err := extractor(r); err == nil {
+        t.Fatal("Invalid token should fail")
+    }
+}
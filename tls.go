@@ -0,0 +1,162 @@
+package common
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "net/http"
+    "os"
+    "slices"
+)
+
+var (
+    ErrInvalidCACertificate    = errors.New("failed to parse ca certificate")
+    ErrPeerCertificateRequired = errors.New("peer certificate is required")
+    ErrPeerNotAllowed          = errors.New("peer is not allowed")
+)
+
+// TLSConfig holds the certificate files of a service, it can be embedded in a config
+// struct loaded by ConfigLoader like so: TLS_CERT_FILE=/run/certs/tls.crt,
+// a named field is prefixed by its key unless it is tagged `envPrefix:""`
+type TLSConfig struct {
+    CertFile string `json:"TLS_CERT_FILE" env:"TLS_CERT_FILE" validate:"required"`
+    KeyFile  string `json:"TLS_KEY_FILE" env:"TLS_KEY_FILE" validate:"required"`
+    CAFile   string `json:"TLS_CA_FILE" env:"TLS_CA_FILE" validate:"required"`
+    // ServerName overrides the name the client verifies the server certificate against
+    ServerName string `json:"TLS_SERVER_NAME" env:"TLS_SERVER_NAME"`
+}
+
+// loadCertPool reads the pem encoded ca certificates from the file
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+    buf, err := os.ReadFile(caFile)
+    if err != nil {
+        return nil, err
+    }
+    pool := x509.NewCertPool()
+    if !pool.AppendCertsFromPEM(buf) {
+        return nil, ErrInvalidCACertificate
+    }
+    return pool, nil
+}
+
+// NewServerTLSConfig creates a tls.Config for a server that requires
+// and verifies client certificates signed by the ca
+func NewServerTLSConfig(config *TLSConfig) (*tls.Config, error) {
+    cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+    if err != nil {
+        return nil, err
+    }
+    pool, err := loadCertPool(config.CAFile)
+    if err != nil {
+        return nil, err
+    }
+    return &tls.Config{
+        Certificates: []tls.Certificate{cert},
+        ClientCAs:    pool,
+        ClientAuth:   tls.RequireAndVerifyClientCert,
+        MinVersion:   tls.VersionTLS12,
+    }, nil
+}
+
+// NewClientTLSConfig creates a tls.Config for a client that presents its certificate
+// and only trusts servers signed by the ca
+func NewClientTLSConfig(config *TLSConfig) (*tls.Config, error) {
+    cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+    if err != nil {
+        return nil, err
+    }
+    pool, err := loadCertPool(config.CAFile)
+    if err != nil {
+        return nil, err
+    }
+    return &tls.Config{
+        Certificates: []tls.Certificate{cert},
+        RootCAs:      pool,
+        ServerName:   config.ServerName,
+        MinVersion:   tls.VersionTLS12,
+    }, nil
+}
+
+// NewHttpClient creates a client like HttpClient that uses the tls config,
+// like so: HttpClient = NewHttpClient(clientTLSConfig)
+func NewHttpClient(tlsConfig *tls.Config) *http.Client {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.TLSClientConfig = tlsConfig
+    return &http.Client{
+        Timeout:   HttpClient.Timeout,
+        Transport: &TenantTransport{Base: transport},
+    }
+}
+
+// PeerIdentity is the identity of the verified client certificate
+type PeerIdentity struct {
+    CommonName   string
+    Organization []string
+    DNSNames     []string
+    URIs         []string
+    SerialNumber string
+    Certificate  *x509.Certificate
+}
+
+// Names returns every name the peer is known by
+func (p *PeerIdentity) Names() []string {
+    names := make([]string, 0, 1+len(p.DNSNames)+len(p.URIs))
+    if p.CommonName != "" {
+        names = append(names, p.CommonName)
+    }
+    names = append(names, p.DNSNames...)
+    return append(names, p.URIs...)
+}
+
+func newPeerIdentity(cert *x509.Certificate) *PeerIdentity {
+    uris := make([]string, 0, len(cert.URIs))
+    for _, uri := range cert.URIs {
+        uris = append(uris, uri.String())
+    }
+    return &PeerIdentity{
+        CommonName:   cert.Subject.CommonName,
+        Organization: cert.Subject.Organization,
+        DNSNames:     cert.DNSNames,
+        URIs:         uris,
+        SerialNumber: cert.SerialNumber.String(),
+        Certificate:  cert,
+    }
+}
+
+// PeerFromContext returns the peer identity set by PeerCertificateMiddleware
+func PeerFromContext(ctx context.Context) (*PeerIdentity, bool) {
+    peer, ok := ctx.Value(PeerContextKey).(*PeerIdentity)
+    return peer, ok
+}
+
+// PeerCertificateMiddleware sets the identity of the verified client certificate in the context,
+// if allowed names are given, the peer must be known by one of them
+func PeerCertificateMiddleware(allowed ...string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                // VerifiedChains is only set when the server verified the client certificate
+                if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+                    w.Header().Set(ContentType, ApplicationJSON)
+                    HandleError(http.StatusUnauthorized, w, ErrPeerCertificateRequired)
+                    return
+                }
+
+                peer := newPeerIdentity(r.TLS.VerifiedChains[0][0])
+
+                if len(allowed) > 0 && !slices.ContainsFunc(peer.Names(), func(name string) bool {
+                    return slices.Contains(allowed, name)
+                }) {
+                    w.Header().Set(ContentType, ApplicationJSON)
+                    HandleError(http.StatusForbidden, w, ErrPeerNotAllowed)
+                    return
+                }
+
+                r = r.WithContext(context.WithValue(r.Context(), PeerContextKey, peer))
+
+                next.ServeHTTP(w, r)
+            },
+        )
+    }
+}
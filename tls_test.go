@@ -0,0 +1,174 @@
+package common
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+type testCertificate struct {
+    cert *x509.Certificate
+    key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    template.SerialNumber = big.NewInt(time.Now().UnixNano())
+    template.NotBefore = time.Now().Add(-time.Minute)
+    template.NotAfter = time.Now().Add(time.Hour)
+
+    signer, signerKey := template, key
+    if parent != nil {
+        signer, signerKey = parent.cert, parent.key
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &testCertificate{cert: cert, key: key}
+}
+
+func writeTestCertificate(t *testing.T, dir, name string, cert *testCertificate) (string, string) {
+    certFile := filepath.Join(dir, name+".crt")
+    keyFile := filepath.Join(dir, name+".key")
+    certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.cert.Raw})
+    if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+        t.Fatal(err)
+    }
+    der, err := x509.MarshalECPrivateKey(cert.key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+    if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return certFile, keyFile
+}
+
+// newTestTLSConfigs creates a ca, a server and a client certificate on disk
+func newTestTLSConfigs(t *testing.T, clientName string) (*TLSConfig, *TLSConfig) {
+    dir := t.TempDir()
+    ca := newTestCertificate(
+        t, &x509.Certificate{
+            Subject:               pkix.Name{CommonName: "test-ca"},
+            IsCA:                  true,
+            BasicConstraintsValid: true,
+            KeyUsage:              x509.KeyUsageCertSign,
+        }, nil,
+    )
+    server := newTestCertificate(
+        t, &x509.Certificate{
+            Subject:     pkix.Name{CommonName: "server"},
+            IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+            ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+        }, ca,
+    )
+    client := newTestCertificate(
+        t, &x509.Certificate{
+            Subject:     pkix.Name{CommonName: clientName},
+            ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+        }, ca,
+    )
+
+    caFile, _ := writeTestCertificate(t, dir, "ca", ca)
+    serverCert, serverKey := writeTestCertificate(t, dir, "server", server)
+    clientCert, clientKey := writeTestCertificate(t, dir, "client", client)
+
+    return &TLSConfig{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile},
+        &TLSConfig{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile}
+}
+
+func newTestMTLSServer(t *testing.T, serverConfig *TLSConfig, allowed ...string) *httptest.Server {
+    tlsConfig, err := NewServerTLSConfig(serverConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    server := httptest.NewUnstartedServer(
+        PeerCertificateMiddleware(allowed...)(
+            http.HandlerFunc(
+                func(w http.ResponseWriter, r *http.Request) {
+                    peer, ok := PeerFromContext(r.Context())
+                    if !ok {
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                    }
+                    _, _ = w.Write([]byte(peer.CommonName))
+                },
+            ),
+        ),
+    )
+    server.TLS = tlsConfig
+    server.StartTLS()
+    return server
+}
+
+func TestPeerCertificateMiddleware(t *testing.T) {
+    serverConfig, clientConfig := newTestTLSConfigs(t, "vehicle-service")
+    server := newTestMTLSServer(t, serverConfig, "vehicle-service")
+    defer server.Close()
+
+    tlsConfig, err := NewClientTLSConfig(clientConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    res, err := NewHttpClient(tlsConfig).Get(server.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        t.Fatalf("Status should be 200, got %d", res.StatusCode)
+    }
+}
+
+func TestPeerCertificateMiddleware_MustFail(t *testing.T) {
+    serverConfig, clientConfig := newTestTLSConfigs(t, "driver-service")
+    server := newTestMTLSServer(t, serverConfig, "vehicle-service")
+    defer server.Close()
+
+    tlsConfig, err := NewClientTLSConfig(clientConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    res, err := NewHttpClient(tlsConfig).Get(server.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusForbidden {
+        t.Fatalf("Status should be 403, got %d", res.StatusCode)
+    }
+
+    // without a client certificate the handshake itself must fail
+    tlsConfig.Certificates = nil
+    if _, err := NewHttpClient(tlsConfig).Get(server.URL); err == nil {
+        t.Fatal("Request without client certificate should fail")
+    }
+
+    w := httptest.NewRecorder()
+    PeerCertificateMiddleware()(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+    if w.Code != http.StatusUnauthorized {
+        t.Fatalf("Status should be 401, got %d", w.Code)
+    }
+}
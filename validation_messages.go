@@ -0,0 +1,461 @@
+package common
+
+import (
+    "errors"
+    "net/http"
+    "reflect"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/go-playground/locales"
+    "github.com/go-playground/locales/en"
+    "github.com/go-playground/locales/my"
+    ut "github.com/go-playground/universal-translator"
+    "github.com/go-playground/validator/v10"
+    entranslations "github.com/go-playground/validator/v10/translations/en"
+)
+
+var ErrUnsupportedLocale = errors.New("unsupported locale")
+
+const (
+    // DefaultLocale is used when the client accepts none of the supported locales
+    DefaultLocale = "en"
+    LocaleBurmese = "my"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// validationTagAliases share the messages of the tags they behave like
+var validationTagAliases = map[string]string{
+    "required_if":          "required",
+    "required_unless":      "required",
+    "required_with":        "required",
+    "required_with_all":    "required",
+    "required_without":     "required",
+    "required_without_all": "required",
+    "excluded_if":          "excluded",
+    "excluded_unless":      "excluded",
+    "excluded_with":        "excluded",
+    "excluded_with_all":    "excluded",
+    "excluded_without":     "excluded",
+    "excluded_without_all": "excluded",
+    "isdefault":            "excluded",
+    "min":                  "gte",
+    "max":                  "lte",
+    "eqfield":              "eq",
+    "eqcsfield":            "eq",
+    "nefield":              "ne",
+    "necsfield":            "ne",
+    "gtfield":              "gt",
+    "gtcsfield":            "gt",
+    "gtefield":             "gte",
+    "gtecsfield":           "gte",
+    "ltfield":              "lt",
+    "ltcsfield":            "lt",
+    "ltefield":             "lte",
+    "ltecsfield":           "lte",
+    "number":               "numeric",
+    "bool":                 "boolean",
+    "startsnotwith":        "excludes",
+    "endsnotwith":          "excludes",
+}
+
+// validationFormats are the tags that check the format of the value, they share the "invalid" message
+var validationFormats = map[string]string{
+    "email":                   "email",
+    "url":                     "url",
+    "http_url":                "url",
+    "uri":                     "uri",
+    "uuid":                    "uuid format",
+    "uuid3":                   "uuid format",
+    "uuid4":                   "uuid format",
+    "uuid5":                   "uuid format",
+    "ulid":                    "ulid format",
+    "jwt":                     "jwt",
+    "json":                    "json",
+    "base64":                  "base64",
+    "base64url":               "base64url",
+    "hexadecimal":             "hexadecimal",
+    "hexcolor":                "hex color",
+    "rgb":                     "rgb color",
+    "rgba":                    "rgba color",
+    "hsl":                     "hsl color",
+    "hsla":                    "hsla color",
+    "iscolor":                 "color",
+    "e164":                    "phone number",
+    "isbn":                    "isbn",
+    "isbn10":                  "isbn",
+    "isbn13":                  "isbn",
+    "issn":                    "issn",
+    "datauri":                 "data uri",
+    "latitude":                "latitude",
+    "longitude":               "longitude",
+    "ssn":                     "ssn",
+    "ip":                      "ip address",
+    "ipv4":                    "ipv4 address",
+    "ipv6":                    "ipv6 address",
+    "ip_addr":                 "ip address",
+    "ip4_addr":                "ipv4 address",
+    "ip6_addr":                "ipv6 address",
+    "cidr":                    "cidr",
+    "cidrv4":                  "cidr",
+    "cidrv6":                  "cidr",
+    "tcp_addr":                "tcp address",
+    "tcp4_addr":               "tcp address",
+    "tcp6_addr":               "tcp address",
+    "udp_addr":                "udp address",
+    "udp4_addr":               "udp address",
+    "udp6_addr":               "udp address",
+    "unix_addr":               "unix address",
+    "mac":                     "mac address",
+    "hostname":                "hostname",
+    "hostname_rfc1123":        "hostname",
+    "fqdn":                    "domain name",
+    "cron":                    "cron expression",
+    "cve":                     "cve identifier",
+    "image":                   "image",
+    "file":                    "file",
+    "dir":                     "directory",
+    "timezone":                "timezone",
+    "country_code":            "country code",
+    "iso3166_1_alpha2":        "country code",
+    "iso3166_1_alpha3":        "country code",
+    "iso4217":                 "currency code",
+    "bcp47_language_tag":      "language tag",
+    "postcode_iso3166_alpha2": "postcode",
+    "semver":                  "semantic version",
+    "mongodb":                 "object id",
+    "md5":                     "md5 hash",
+    "sha256":                  "sha256 hash",
+    "btc_addr":                "bitcoin address",
+    "eth_addr":                "ethereum address",
+    "credit_card":             "credit card number",
+    "luhn_checksum":           "checksum",
+    "e164_phone":              "phone number",
+    "vin":                     "vehicle identification number",
+    "mm_plate":                "license plate number",
+    "imei":                    "imei number",
+    "latlng":                  "coordinates",
+    "speed":                   "speed",
+}
+
+// validationMessages are the messages of the tags by locale, the keys are suffixed by the kind of the field
+// for the tags whose message depends on it, like gte.string and gte.items, and {0} is the param of the tag,
+// the English messages of the built-in tags come from validator/v10/translations/en, see RegisterValidationTranslations
+var validationMessages = map[string]map[string]string{
+    DefaultLocale: {
+        "invalid": "Invalid {0}",
+        "unknown": "Invalid value",
+        "speed":   "Must be a speed between 0 and {0} km/h",
+    },
+    LocaleBurmese: {
+        "required":            "ဤအကွက်ကို ဖြည့်ရန် လိုအပ်ပါသည်",
+        "excluded":            "ဤအကွက်ကို မဖြည့်ရပါ",
+        "invalid":             "{0} မမှန်ကန်ပါ",
+        "unknown":             "တန်ဖိုး မမှန်ကန်ပါ",
+        "uuid":                "uuid ပုံစံ မမှန်ကန်ပါ",
+        "jwt":                 "jwt ပုံစံ မမှန်ကန်ပါ",
+        "boolean":             "boolean တန်ဖိုး မမှန်ကန်ပါ",
+        "len.string":          "စာလုံး {0} လုံး အတိအကျ ရှိရမည်",
+        "len.items":           "{0} ခု အတိအကျ ပါဝင်ရမည်",
+        "len":                 "{0} နှင့် ညီရမည်",
+        "gte.string":          "အနည်းဆုံး စာလုံး {0} လုံး ရှိရမည်",
+        "gte.items":           "အနည်းဆုံး {0} ခု ပါဝင်ရမည်",
+        "gte.time":            "လက်ရှိအချိန် သို့မဟုတ် ထို့နောက် ဖြစ်ရမည်",
+        "gte":                 "{0} သို့မဟုတ် ထို့ထက် ကြီးရမည်",
+        "gt.string":           "စာလုံး {0} လုံးထက် ပိုရှိရမည်",
+        "gt.items":            "{0} ခုထက် ပိုပါဝင်ရမည်",
+        "gt.time":             "လက်ရှိအချိန်ထက် နောက်ကျရမည်",
+        "gt":                  "{0} ထက် ကြီးရမည်",
+        "lte.string":          "အများဆုံး စာလုံး {0} လုံးသာ ရှိရမည်",
+        "lte.items":           "အများဆုံး {0} ခုသာ ပါဝင်ရမည်",
+        "lte.time":            "လက်ရှိအချိန် သို့မဟုတ် ထို့ရှေ့ ဖြစ်ရမည်",
+        "lte":                 "{0} သို့မဟုတ် ထို့ထက် ငယ်ရမည်",
+        "lt.string":           "စာလုံး {0} လုံးထက် နည်းရမည်",
+        "lt.items":            "{0} ခုထက် နည်းရမည်",
+        "lt.time":             "လက်ရှိအချိန်ထက် စောရမည်",
+        "lt":                  "{0} ထက် ငယ်ရမည်",
+        "eq":                  "{0} နှင့် ညီရမည်",
+        "ne":                  "{0} နှင့် မညီရပါ",
+        "oneof":               "[{0}] ထဲမှ တစ်ခု ဖြစ်ရမည်",
+        "alpha":               "အက္ခရာများသာ ပါဝင်ရမည်",
+        "alphanum":            "အက္ခရာနှင့် ဂဏန်းများသာ ပါဝင်ရမည်",
+        "alphaunicode":        "စာလုံးများသာ ပါဝင်ရမည်",
+        "numeric":             "ဂဏန်း ဖြစ်ရမည်",
+        "ascii":               "ASCII စာလုံးများသာ ပါဝင်ရမည်",
+        "printascii":          "ပုံနှိပ်နိုင်သော ASCII စာလုံးများသာ ပါဝင်ရမည်",
+        "multibyte":           "multibyte စာလုံးများ ပါဝင်ရမည်",
+        "lowercase":           "စာလုံးအသေးများသာ ဖြစ်ရမည်",
+        "uppercase":           "စာလုံးအကြီးများသာ ဖြစ်ရမည်",
+        "contains":            "'{0}' ပါဝင်ရမည်",
+        "containsany":         "'{0}' ထဲမှ အနည်းဆုံး တစ်လုံး ပါဝင်ရမည်",
+        "containsrune":        "'{0}' ပါဝင်ရမည်",
+        "excludes":            "'{0}' မပါဝင်ရပါ",
+        "excludesall":         "'{0}' ထဲမှ မည်သည့်စာလုံးမျှ မပါဝင်ရပါ",
+        "excludesrune":        "'{0}' မပါဝင်ရပါ",
+        "startswith":          "'{0}' ဖြင့် စရမည်",
+        "endswith":            "'{0}' ဖြင့် ဆုံးရမည်",
+        "unique":              "တန်ဖိုးများ မထပ်ရပါ",
+        "datetime":            "{0} ပုံစံ ဖြစ်ရမည်",
+        "speed":               "အမြန်နှုန်းသည် 0 မှ {0} km/h အတွင်း ဖြစ်ရမည်",
+        "format.email":        "အီးမေးလ်",
+        "format.phone number": "ဖုန်းနံပါတ်",
+        "format.latitude":     "လတ္တီကျု",
+        "format.longitude":    "လောင်ဂျီကျု",
+
+        // the names of the fleet formats, see RegisterFleetValidators
+        "format.vehicle identification number": "ယာဉ်အမှတ် (VIN)",
+        "format.license plate number":          "ယာဉ်နံပါတ်",
+        "format.imei number":                   "IMEI နံပါတ်",
+        "format.coordinates":                   "တည်နေရာ",
+        "format.speed":                         "အမြန်နှုန်း",
+    },
+}
+
+// formatValidationMessages are the English messages of FormatValidationMessage, they take no param
+var formatValidationMessages = map[string]string{
+    "required": "This field is required",
+    "excluded": "This field must be empty",
+    "uuid":     "Invalid uuid format",
+    "jwt":      "Malformed jwt",
+    "boolean":  "Invalid boolean value",
+}
+
+// validationTranslator holds a translator per supported locale, services can add their own messages
+var validationTranslator = struct {
+    sync.RWMutex
+    *ut.UniversalTranslator
+}{
+    UniversalTranslator: newValidationTranslator(),
+}
+
+func newValidationTranslator() *ut.UniversalTranslator {
+    translator := ut.New(en.New(), en.New(), my.New())
+    for locale, messages := range validationMessages {
+        trans, _ := translator.GetTranslator(locale)
+        for key, message := range messages {
+            if err := trans.Add(key, message, false); err != nil {
+                panic(err)
+            }
+        }
+    }
+    return translator
+}
+
+// defaultTranslator is the translator of validator/v10/translations/en, shared by every validator,
+// the messages are the same for every validator, so a validator registered later overrides them with themselves
+type defaultTranslator struct {
+    ut.Translator
+}
+
+func (t defaultTranslator) Add(key any, text string, _ bool) error {
+    return t.Translator.Add(key, text, true)
+}
+
+func (t defaultTranslator) AddCardinal(key any, text string, rule locales.PluralRule, _ bool) error {
+    return t.Translator.AddCardinal(key, text, rule, true)
+}
+
+func (t defaultTranslator) AddOrdinal(key any, text string, rule locales.PluralRule, _ bool) error {
+    return t.Translator.AddOrdinal(key, text, rule, true)
+}
+
+func (t defaultTranslator) AddRange(key any, text string, rule locales.PluralRule, _ bool) error {
+    return t.Translator.AddRange(key, text, rule, true)
+}
+
+// defaultValidationTranslator holds the English messages of the built-in tags, apart from the custom messages
+var defaultValidationTranslator = struct {
+    sync.RWMutex
+    defaultTranslator
+}{
+    defaultTranslator: newDefaultTranslator(),
+}
+
+func newDefaultTranslator() defaultTranslator {
+    trans := defaultTranslator{ut.New(en.New()).GetFallback()}
+    // the messages are registered up front, so FormatValidationMessageWithParam has them without a validator
+    if err := entranslations.RegisterDefaultTranslations(validator.New(), trans); err != nil {
+        panic(err)
+    }
+    return trans
+}
+
+// RegisterValidationTranslations registers the English messages of validator/v10/translations/en on the validator,
+// NewValidator registers them already, the errors of other validators only get the custom messages
+func RegisterValidationTranslations(validate *validator.Validate) error {
+    defaultValidationTranslator.Lock()
+    defer defaultValidationTranslator.Unlock()
+    return entranslations.RegisterDefaultTranslations(validate, defaultValidationTranslator.defaultTranslator)
+}
+
+// RegisterValidationMessage adds the message of a custom tag, like so:
+// RegisterValidationMessage("en", "fleet_code", "Must be a fleet code like {0}")
+// {0} is replaced by the param of the tag, the message of an existing tag is overridden
+func RegisterValidationMessage(locale, tag, message string) error {
+    validationTranslator.Lock()
+    defer validationTranslator.Unlock()
+
+    trans, found := validationTranslator.GetTranslator(locale)
+    if !found {
+        return ErrUnsupportedLocale
+    }
+    return trans.Add(tag, message, true)
+}
+
+// validationKind returns the suffix of the message keys whose message depends on the kind of the field
+func validationKind(kind reflect.Kind, t reflect.Type) string {
+    switch kind {
+    case reflect.String:
+        return "string"
+    case reflect.Slice, reflect.Array, reflect.Map:
+        return "items"
+    case reflect.Struct:
+        if t == timeType {
+            return "time"
+        }
+    }
+    return ""
+}
+
+// translateKey translates the key with the params, false if it is missing or its message needs a param
+// that is empty, which would leave a gap like "Must be  or greater"
+func translateKey(trans ut.Translator, key string, params ...string) (string, bool) {
+    const missing = "\x00"
+    args := make([]string, len(params))
+    for i, param := range params {
+        if param == "" {
+            param = missing
+        }
+        args[i] = param
+    }
+    message, err := trans.T(key, args...)
+    if err != nil || strings.Contains(message, missing) {
+        return "", false
+    }
+    return message, true
+}
+
+// translateValidation translates the message of the tag with the messages of the translator,
+// false if it has no message for the tag or its alias
+func translateValidation(trans ut.Translator, tag, param string, kind reflect.Kind, t reflect.Type) (string, bool) {
+    // the messages of the tag win over the messages of its alias, so custom messages can override them
+    suffix := validationKind(kind, t)
+    tags := []string{tag}
+    if alias, ok := validationTagAliases[tag]; ok {
+        tags = append(tags, alias)
+    }
+    for _, tag := range tags {
+        if suffix != "" {
+            if message, ok := translateKey(trans, tag+"."+suffix, param); ok {
+                return message, true
+            }
+        }
+        if message, ok := translateKey(trans, tag, param); ok {
+            return message, true
+        }
+    }
+    return "", false
+}
+
+// translateFormat translates the message of the tags that check the format of the value, like "Invalid email",
+// the names of the formats are translated if the translator knows them
+func translateFormat(trans ut.Translator, tag string) (string, bool) {
+    format, ok := validationFormats[tag]
+    if !ok {
+        return "", false
+    }
+    if name, err := trans.T("format." + format); err == nil {
+        format = name
+    }
+    message, err := trans.T("invalid", format)
+    return message, err == nil
+}
+
+// TranslateValidationError returns the message of the field error in the locale, like so:
+// "name must be at least 3 characters in length" for min=3 on a string,
+// the messages that are missing in the locale fall back to English
+func TranslateValidationError(field validator.FieldError, locale string) string {
+    validationTranslator.RLock()
+    defer validationTranslator.RUnlock()
+
+    fallback := validationTranslator.GetFallback()
+    if trans, found := validationTranslator.GetTranslator(locale); found && trans != fallback {
+        if message, ok := translateValidation(trans, field.Tag(), field.Param(), field.Kind(), field.Type()); ok {
+            return message
+        }
+        if message, ok := translateFormat(trans, field.Tag()); ok {
+            return message
+        }
+    }
+
+    // the custom messages win over the messages of the built-in tags
+    if message, ok := translateValidation(fallback, field.Tag(), field.Param(), field.Kind(), field.Type()); ok {
+        return message
+    }
+    defaultValidationTranslator.RLock()
+    message := field.Translate(defaultValidationTranslator.defaultTranslator)
+    defaultValidationTranslator.RUnlock()
+    // the field error is its own message when the validator has no translation for the tag
+    if message != field.Error() {
+        return message
+    }
+    if message, ok := translateFormat(fallback, field.Tag()); ok {
+        return message
+    }
+    message, _ = fallback.T("unknown")
+    return message
+}
+
+// LocaleFromRequest returns the supported locale the client prefers in the Accept-Language header,
+// like so: "my-MM,my;q=0.9,en;q=0.8" is "my"
+func LocaleFromRequest(r *http.Request) string {
+    type preference struct {
+        locale  string
+        quality float64
+    }
+
+    var preferences []preference
+    for _, accepted := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+        tag, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+        quality := 1.0
+        if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            parsed, err := strconv.ParseFloat(q, 64)
+            if err != nil {
+                continue
+            }
+            quality = parsed
+        }
+        if tag == "" || quality <= 0 {
+            continue
+        }
+        preferences = append(preferences, preference{strings.ToLower(strings.ReplaceAll(tag, "-", "_")), quality})
+    }
+    slices.SortStableFunc(
+        preferences, func(a, b preference) int {
+            switch {
+            case a.quality > b.quality:
+                return -1
+            case a.quality < b.quality:
+                return 1
+            }
+            return 0
+        },
+    )
+
+    validationTranslator.RLock()
+    defer validationTranslator.RUnlock()
+    for _, preference := range preferences {
+        // my_MM is served by my
+        base, _, _ := strings.Cut(preference.locale, "_")
+        for _, locale := range []string{preference.locale, base} {
+            if _, found := validationTranslator.GetTranslator(locale); found {
+                return locale
+            }
+        }
+    }
+    return DefaultLocale
+}
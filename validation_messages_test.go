@@ -0,0 +1,195 @@
+package common
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-playground/validator/v10"
+    "github.com/goccy/go-json"
+)
+
+type TripRequest struct {
+    Name      string    `validate:"min=3"`
+    Stops     []string  `validate:"max=2"`
+    Speed     int       `validate:"gte=0,lte=200"`
+    Status    string    `validate:"oneof=scheduled started"`
+    Latitude  float64   `validate:"latitude"`
+    Email     string    `validate:"required_with=Name,omitempty,email"`
+    StartedAt time.Time `validate:"gt"`
+    Code      string    `validate:"len=4"`
+}
+
+func validationMessagesOf(t *testing.T, request *TripRequest, locale string) map[string]string {
+    err := NewValidator().Struct(request)
+
+    var validationErrors validator.ValidationErrors
+    if !errors.As(err, &validationErrors) {
+        t.Fatalf("Request should fail the validation, got %v", err)
+    }
+    messages := make(map[string]string)
+    for _, field := range validationErrors {
+        messages[field.Field()] = TranslateValidationError(field, locale)
+    }
+    return messages
+}
+
+func TestTranslateValidationError(t *testing.T) {
+    request := &TripRequest{
+        Name:      "ab",
+        Stops:     []string{"a", "b", "c"},
+        Speed:     250,
+        Status:    "parked",
+        Latitude:  91,
+        Email:     "invalid",
+        StartedAt: time.Now().Add(-time.Hour),
+        Code:      "12345",
+    }
+
+    expected := map[string]string{
+        "Name":      "Name must be at least 3 characters in length",
+        "Stops":     "Stops must contain at maximum 2 items",
+        "Speed":     "Speed must be 200 or less",
+        "Status":    "Status must be one of [scheduled started]",
+        "Latitude":  "Latitude must contain valid latitude coordinates",
+        "Email":     "Email must be a valid email address",
+        "StartedAt": "StartedAt must be greater than the current Date & Time",
+        "Code":      "Code must be 4 characters in length",
+    }
+    messages := validationMessagesOf(t, request, DefaultLocale)
+    for field, message := range expected {
+        if messages[field] != message {
+            t.Errorf("Message of %s should be %q, got %q", field, message, messages[field])
+        }
+    }
+
+    burmese := map[string]string{
+        "Name":     "အနည်းဆုံး စာလုံး 3 လုံး ရှိရမည်",
+        "Speed":    "200 သို့မဟုတ် ထို့ထက် ငယ်ရမည်",
+        "Latitude": "လတ္တီကျု မမှန်ကန်ပါ",
+    }
+    messages = validationMessagesOf(t, request, LocaleBurmese)
+    for field, message := range burmese {
+        if messages[field] != message {
+            t.Errorf("Message of %s should be %q, got %q", field, message, messages[field])
+        }
+    }
+}
+
+func TestFormatValidationMessage(t *testing.T) {
+    // the messages before the translations must not change, the tags with a param have no placeholder left
+    tests := map[string]string{
+        "required":    "This field is required",
+        "required_if": "This field is required",
+        "email":       "Invalid email",
+        "jwt":         "Malformed jwt",
+        "uuid":        "Invalid uuid format",
+        "bool":        "Invalid boolean value",
+        "ipv4":        "Invalid ipv4 address",
+        "min":         "Invalid value",
+        "speed":       "Invalid speed",
+        "unknown":     "Invalid value",
+    }
+    for tag, message := range tests {
+        if FormatValidationMessage(tag) != message {
+            t.Errorf("Message of %s should be %q, got %q", tag, message, FormatValidationMessage(tag))
+        }
+    }
+}
+
+func TestFormatValidationMessageWithParam(t *testing.T) {
+    tests := []struct {
+        tag, param, locale, message string
+    }{
+        {"min", "3", DefaultLocale, "This field must be 3 or greater"},
+        {"max", "10", DefaultLocale, "This field must be 10 or less"},
+        {"len", "4", DefaultLocale, "This field must be equal to 4"},
+        {"gte", "0", DefaultLocale, "This field must be 0 or greater"},
+        {"oneof", "active idle", DefaultLocale, "This field must be one of [active idle]"},
+        {"required", "", DefaultLocale, "This field is required"},
+        {"email", "", DefaultLocale, "Invalid email"},
+        {"min", "", DefaultLocale, "Invalid value"},
+        {"min", "3", LocaleBurmese, "3 သို့မဟုတ် ထို့ထက် ကြီးရမည်"},
+        {"oneof", "active idle", LocaleBurmese, "[active idle] ထဲမှ တစ်ခု ဖြစ်ရမည်"},
+    }
+    for _, test := range tests {
+        if message := FormatValidationMessageWithParam(test.tag, test.param, test.locale); message != test.message {
+            t.Errorf(
+                "Message of %s=%s in %s should be %q, got %q", test.tag, test.param, test.locale, test.message,
+                message,
+            )
+        }
+    }
+}
+
+func TestRegisterValidationMessage(t *testing.T) {
+    if err := RegisterValidationMessage(DefaultLocale, "fleet_code", "Must be a fleet code like {0}"); err != nil {
+        t.Fatal(err)
+    }
+    validate := NewValidator()
+    err := validate.RegisterValidation(
+        "fleet_code", func(fl validator.FieldLevel) bool {
+            return strings.HasPrefix(fl.Field().String(), fl.Param())
+        },
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    fieldErrors, ok := validate.Var("MDY-01", "fleet_code=YGN").(validator.ValidationErrors)
+    if !ok {
+        t.Fatal("Value should fail the validation")
+    }
+
+    message := TranslateValidationError(fieldErrors[0], DefaultLocale)
+    if message != "Must be a fleet code like YGN" {
+        t.Fatalf("Custom message should be used, got %q", message)
+    }
+    // the locales without the message fall back to English
+    if TranslateValidationError(fieldErrors[0], LocaleBurmese) != message {
+        t.Fatal("Missing messages should fall back to English")
+    }
+
+    if err := RegisterValidationMessage("fr", "fleet_code", "Code de flotte"); !errors.Is(err, ErrUnsupportedLocale) {
+        t.Fatalf("Unsupported locales should fail, got %v", err)
+    }
+}
+
+func TestLocaleFromRequest(t *testing.T) {
+    tests := map[string]string{
+        "":                         DefaultLocale,
+        "fr-FR":                    DefaultLocale,
+        "my-MM":                    LocaleBurmese,
+        "en-US,en;q=0.9,my;q=0.8":  DefaultLocale,
+        "fr;q=1,en;q=0.5,my;q=0.9": LocaleBurmese,
+        "my;q=0,en":                DefaultLocale,
+    }
+    for acceptLanguage, locale := range tests {
+        r := httptest.NewRequest(http.MethodGet, "/", nil)
+        r.Header.Set("Accept-Language", acceptLanguage)
+        if LocaleFromRequest(r) != locale {
+            t.Errorf("Locale of %q should be %s, got %s", acceptLanguage, locale, LocaleFromRequest(r))
+        }
+    }
+}
+
+func TestErrorNegotiationMiddleware_Locale(t *testing.T) {
+    err := validator.New().Struct(&problemTestRequest{})
+
+    r := httptest.NewRequest(http.MethodPost, "/drivers", nil)
+    r.Header.Set("Accept-Language", "my-MM")
+    w := httptest.NewRecorder()
+    ErrorNegotiationMiddleware(errorHandler(err)).ServeHTTP(w, r)
+
+    var response struct {
+        Error map[string]string `json:"error"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if response.Error["email"] != "ဤအကွက်ကို ဖြည့်ရန် လိုအပ်ပါသည်" {
+        t.Fatalf("Messages should be in Burmese, got %v", response.Error)
+    }
+}
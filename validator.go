@@ -0,0 +1,54 @@
+package common
+
+import (
+    "reflect"
+    "strings"
+
+    "github.com/go-playground/validator/v10"
+)
+
+// NewValidator creates the validator shared by the services and ConfigLoader,
+// the errors are named by the json tags, so they match the fields the client sent
+func NewValidator() *validator.Validate {
+    validate := validator.New(
+        validator.WithRequiredStructEnabled(),
+    )
+    validate.RegisterTagNameFunc(jsonTagName)
+    // the secrets are validated by their values, like so: `validate:"required,min=32"`
+    validate.RegisterCustomTypeFunc(redactedSecretValue, Redacted[string]{}, Redacted[[]byte]{})
+    if err := RegisterValidationTranslations(validate); err != nil {
+        panic(err)
+    }
+    return validate
+}
+
+// redactedSecretValue returns the value of a Redacted field for the validator
+func redactedSecretValue(v reflect.Value) any {
+    if secret, ok := v.Interface().(redactedSecret); ok {
+        return secret.secretValue()
+    }
+    return nil
+}
+
+// jsonTagName returns the name of the field in the json tag, empty to fall back to the field name
+func jsonTagName(field reflect.StructField) string {
+    name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+    if name == "-" {
+        return ""
+    }
+    return name
+}
+
+// validationErrorKey returns the key of the field error, the namespace without the root struct,
+// like stops[2].latitude, the names are lowercased if the validator has no tag name function
+func validationErrorKey(field validator.FieldError) string {
+    namespace := field.Namespace()
+    if _, key, ok := strings.Cut(namespace, "."); ok {
+        namespace = key
+    }
+    // without a tag name function the namespace is the struct namespace
+    if field.Namespace() == field.StructNamespace() {
+        return strings.ToLower(namespace)
+    }
+    return namespace
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+    "testing"
+)
+
+type TripStop struct {
+    Latitude  float64 `json:"latitude" validate:"latitude"`
+    Longitude float64 `json:"longitude" validate:"longitude"`
+}
+
+type CreateTripRequest struct {
+    VehicleID string     `json:"vehicle_id" validate:"required"`
+    Stops     []TripStop `json:"stops" validate:"dive"`
+    Origin    TripStop   `json:"origin"`
+    Note      string     `json:"-" validate:"max=3"`
+}
+
+func TestNewValidator(t *testing.T) {
+    err := NewValidator().Struct(
+        &CreateTripRequest{
+            Stops:  []TripStop{{}, {}, {Latitude: 91}},
+            Origin: TripStop{Longitude: 181},
+            Note:   "long note",
+        },
+    )
+
+    response := DefaultErrorResponse(err)
+    messages, ok := response.Error.(map[string]string)
+    if !ok {
+        t.Fatalf("Validation errors should be set, got %v", response.Error)
+    }
+
+    expected := map[string]string{
+        "vehicle_id":        "vehicle_id is a required field",
+        "stops[2].latitude": "latitude must contain valid latitude coordinates",
+        "origin.longitude":  "longitude must contain a valid longitude coordinates",
+        "note":              "Note must be a maximum of 3 characters in length",
+    }
+    if len(messages) != len(expected) {
+        t.Fatalf("Errors should be %v, got %v", expected, messages)
+    }
+    for key, message := range expected {
+        if messages[key] != message {
+            t.Errorf("Message of %s should be %q, got %q", key, message, messages[key])
+        }
+    }
+}
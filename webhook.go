@@ -0,0 +1,493 @@
+package common
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math/rand/v2"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/goccy/go-json"
+    amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+    ErrWebhookDeliveryFailed = errors.New("webhook delivery failed")
+)
+
+const (
+    defaultWebhookMaxAttempts    = 5
+    defaultWebhookMaxConcurrency = 4
+    maxWebhookBackoff            = time.Minute
+    // the retries of a consumed event carry the endpoints that are left and their next attempt
+    webhookEndpointsHeader = "x-webhook-endpoints"
+    webhookAttemptHeader   = "x-webhook-attempt"
+)
+
+// WebhookEvent is an event that is delivered to the subscribed endpoints
+type WebhookEvent struct {
+    ID        string          `json:"id"`
+    Type      string          `json:"type"`
+    TenantID  string          `json:"tenant_id,omitempty"`
+    CreatedAt time.Time       `json:"created_at"`
+    Data      json.RawMessage `json:"data"`
+}
+
+// WebhookEndpoint is a customer endpoint, the payloads are signed with its secret
+type WebhookEndpoint struct {
+    ID     string
+    URL    string
+    Secret string
+    // Events are the subscribed event types, empty means every event
+    Events []string
+    // MaxConcurrency limits the deliveries in flight to the endpoint, the dispatcher's default if zero
+    MaxConcurrency int
+}
+
+// Subscribed checks if the endpoint is subscribed to the event type
+func (e *WebhookEndpoint) Subscribed(eventType string) bool {
+    return len(e.Events) == 0 || slices.Contains(e.Events, eventType)
+}
+
+// WebhookAttempt is a single delivery attempt of an event to an endpoint
+type WebhookAttempt struct {
+    EventID     string
+    EndpointID  string
+    Attempt     int
+    StatusCode  int
+    Error       string
+    Delivered   bool
+    Duration    time.Duration
+    AttemptedAt time.Time
+}
+
+// WebhookStore provides the endpoints and records the delivery attempts
+type WebhookStore interface {
+    // Endpoints returns the endpoints subscribed to the event
+    Endpoints(ctx context.Context, event *WebhookEvent) ([]*WebhookEndpoint, error)
+    RecordAttempt(ctx context.Context, attempt *WebhookAttempt) error
+}
+
+// MemoryWebhookStore is an in-memory WebhookStore, useful for tests and static endpoints
+type MemoryWebhookStore struct {
+    sync.Mutex
+
+    endpoints []*WebhookEndpoint
+    attempts  []*WebhookAttempt
+}
+
+// NewMemoryWebhookStore creates a new MemoryWebhookStore
+func NewMemoryWebhookStore(endpoints ...*WebhookEndpoint) *MemoryWebhookStore {
+    return &MemoryWebhookStore{endpoints: endpoints}
+}
+
+// Endpoints implements WebhookStore
+func (s *MemoryWebhookStore) Endpoints(_ context.Context, event *WebhookEvent) ([]*WebhookEndpoint, error) {
+    s.Lock()
+    defer s.Unlock()
+    var endpoints []*WebhookEndpoint
+    for _, endpoint := range s.endpoints {
+        if endpoint.Subscribed(event.Type) {
+            endpoints = append(endpoints, endpoint)
+        }
+    }
+    return endpoints, nil
+}
+
+// RecordAttempt implements WebhookStore
+func (s *MemoryWebhookStore) RecordAttempt(_ context.Context, attempt *WebhookAttempt) error {
+    s.Lock()
+    defer s.Unlock()
+    s.attempts = append(s.attempts, attempt)
+    return nil
+}
+
+// Attempts returns the recorded attempts
+func (s *MemoryWebhookStore) Attempts() []*WebhookAttempt {
+    s.Lock()
+    defer s.Unlock()
+    return slices.Clone(s.attempts)
+}
+
+// WebhookConfig configures the WebhookDispatcher
+type WebhookConfig struct {
+    // Client sends the deliveries, HttpClient by default
+    Client *http.Client
+    // MaxAttempts is the number of attempts per endpoint, 5 by default
+    MaxAttempts int
+    // MaxConcurrency limits the deliveries in flight per endpoint, 4 by default
+    MaxConcurrency int
+    // Backoff returns the wait before the next attempt, exponential with jitter by default
+    Backoff func(attempt int) time.Duration
+    // SignedHeaders are signed in addition to the timestamp, nonce and webhook headers
+    SignedHeaders []string
+}
+
+// WebhookDispatcher delivers signed events to the subscribed endpoints with retries
+type WebhookDispatcher struct {
+    sync.Mutex
+
+    config WebhookConfig
+    store  WebhookStore
+    limits map[string]chan struct{}
+}
+
+// NewWebhookDispatcher creates a new WebhookDispatcher
+func NewWebhookDispatcher(store WebhookStore, config *WebhookConfig) *WebhookDispatcher {
+    if config == nil {
+        config = &WebhookConfig{}
+    }
+    dispatcherConfig := *config
+    if dispatcherConfig.Client == nil {
+        dispatcherConfig.Client = HttpClient
+    }
+    if dispatcherConfig.MaxAttempts <= 0 {
+        dispatcherConfig.MaxAttempts = defaultWebhookMaxAttempts
+    }
+    if dispatcherConfig.MaxConcurrency <= 0 {
+        dispatcherConfig.MaxConcurrency = defaultWebhookMaxConcurrency
+    }
+    if dispatcherConfig.Backoff == nil {
+        dispatcherConfig.Backoff = ExponentialBackoff
+    }
+    return &WebhookDispatcher{
+        config: dispatcherConfig,
+        store:  store,
+        limits: make(map[string]chan struct{}),
+    }
+}
+
+// ExponentialBackoff doubles the wait on every attempt starting at a second,
+// up to a minute, with jitter so retries of many deliveries don't arrive together
+func ExponentialBackoff(attempt int) time.Duration {
+    backoff := maxWebhookBackoff
+    if attempt < 6 {
+        backoff = min(time.Second<<attempt, maxWebhookBackoff)
+    }
+    return backoff/2 + rand.N(backoff/2)
+}
+
+// limit returns the semaphore of the endpoint
+func (d *WebhookDispatcher) limit(endpoint *WebhookEndpoint) chan struct{} {
+    d.Lock()
+    defer d.Unlock()
+    limit, ok := d.limits[endpoint.ID]
+    if !ok {
+        size := endpoint.MaxConcurrency
+        if size <= 0 {
+            size = d.config.MaxConcurrency
+        }
+        limit = make(chan struct{}, size)
+        d.limits[endpoint.ID] = limit
+    }
+    return limit
+}
+
+// Dispatch delivers the event to every subscribed endpoint and waits for the deliveries,
+// the returned error wraps ErrWebhookDeliveryFailed if an endpoint ran out of attempts
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, event *WebhookEvent) error {
+    event, body, err := d.prepare(ctx, event)
+    if err != nil {
+        return err
+    }
+
+    endpoints, err := d.store.Endpoints(ctx, event)
+    if err != nil {
+        return err
+    }
+
+    var wg sync.WaitGroup
+    errs := make([]error, len(endpoints))
+    for i, endpoint := range endpoints {
+        wg.Add(1)
+        go func(i int, endpoint *WebhookEndpoint) {
+            defer wg.Done()
+            errs[i] = d.deliver(ctx, endpoint, event, body)
+        }(i, endpoint)
+    }
+    wg.Wait()
+
+    return errors.Join(errs...)
+}
+
+// prepare copies the event with the tenant of the context, the caller's event is not modified
+func (d *WebhookDispatcher) prepare(ctx context.Context, event *WebhookEvent) (*WebhookEvent, []byte, error) {
+    prepared := *event
+    if prepared.TenantID == "" {
+        prepared.TenantID, _ = TenantFromContext(ctx)
+    }
+
+    body, err := json.Marshal(&prepared)
+    if err != nil {
+        return nil, nil, err
+    }
+    return &prepared, body, nil
+}
+
+// deliver retries the delivery to the endpoint until it succeeds or runs out of attempts
+func (d *WebhookDispatcher) deliver(ctx context.Context, endpoint *WebhookEndpoint, event *WebhookEvent, body []byte) error {
+    for attempt := 1; ; attempt++ {
+        record, retry, err := d.attempt(ctx, endpoint, event, body, attempt)
+        if err != nil {
+            return err
+        }
+
+        if record.Delivered {
+            return nil
+        }
+
+        if !retry || attempt >= d.config.MaxAttempts {
+            return deliveryFailed(event, endpoint, record)
+        }
+
+        timer := time.NewTimer(d.config.Backoff(attempt))
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        }
+    }
+}
+
+// attempt sends the event once within the concurrency limit of the endpoint and records the attempt
+func (d *WebhookDispatcher) attempt(
+    ctx context.Context,
+    endpoint *WebhookEndpoint,
+    event *WebhookEvent,
+    body []byte,
+    attempt int,
+) (*WebhookAttempt, bool, error) {
+    limit := d.limit(endpoint)
+
+    // the slot is only held while sending, not while waiting for the next attempt
+    select {
+    case limit <- struct{}{}:
+    case <-ctx.Done():
+        return nil, false, ctx.Err()
+    }
+    record, retry := d.send(ctx, endpoint, event, body, attempt)
+    <-limit
+
+    if err := d.store.RecordAttempt(ctx, record); err != nil {
+        log.Println("Failed to record webhook attempt", err)
+    }
+    return record, retry, nil
+}
+
+// deliveryFailed is the error of an endpoint that won't be attempted again
+func deliveryFailed(event *WebhookEvent, endpoint *WebhookEndpoint, record *WebhookAttempt) error {
+    return fmt.Errorf(
+        "%w: %s to %s after %d attempts: %s",
+        ErrWebhookDeliveryFailed, event.ID, endpoint.ID, record.Attempt, record.Error,
+    )
+}
+
+// send makes a single attempt, it reports if a failed attempt is worth retrying
+func (d *WebhookDispatcher) send(
+    ctx context.Context,
+    endpoint *WebhookEndpoint,
+    event *WebhookEvent,
+    body []byte,
+    attempt int,
+) (*WebhookAttempt, bool) {
+    record := &WebhookAttempt{
+        EventID:     event.ID,
+        EndpointID:  endpoint.ID,
+        Attempt:     attempt,
+        AttemptedAt: time.Now(),
+    }
+
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+    if err != nil {
+        record.Error = err.Error()
+        return record, false
+    }
+    request.Header.Set(ContentType, ApplicationJSON)
+    request.Header.Set(XWebhookEventID, event.ID)
+    request.Header.Set(XWebhookEventType, event.Type)
+
+    // every attempt is signed again, so its timestamp is within the receiver's window
+    signedHeaders := append([]string{ContentType, XWebhookEventID, XWebhookEventType}, d.config.SignedHeaders...)
+    if err := SignRequest(request, body, "", endpoint.Secret, signedHeaders); err != nil {
+        record.Error = err.Error()
+        return record, false
+    }
+
+    res, err := d.config.Client.Do(request)
+    record.Duration = time.Since(record.AttemptedAt)
+    if err != nil {
+        record.Error = err.Error()
+        return record, true
+    }
+    defer func(Body io.ReadCloser) {
+        // draining the body lets the connection be reused
+        _, _ = io.Copy(io.Discard, Body)
+        if err := Body.Close(); err != nil {
+            log.Println("Error closing response body", err)
+        }
+    }(res.Body)
+
+    record.StatusCode = res.StatusCode
+    if res.StatusCode >= 200 && res.StatusCode < 300 {
+        record.Delivered = true
+        return record, false
+    }
+
+    record.Error = res.Status
+    // other client errors won't succeed by sending the same payload again
+    retry := res.StatusCode >= 500 || res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests
+    return record, retry
+}
+
+// webhookRetry is the next round of a consumed event, it is published to the retry queue of the attempt
+type webhookRetry struct {
+    attempt int
+    message amqp.Publishing
+}
+
+// Consume feeds the dispatcher from the queue, the messages must be json encoded WebhookEvent,
+// every endpoint is attempted once per message so a slow endpoint doesn't hold the queue, the endpoints
+// that should be retried are published with the event to the retry queue of the attempt, like webhooks.retry.2,
+// which dead letters it back to the queue after the backoff, endpoints that ran out of attempts are dropped
+// since their attempts are recorded in the store
+func (d *WebhookDispatcher) Consume(ctx context.Context, conn *RabbitConnection, queue string) error {
+    return conn.Consume(
+        ctx, queue, func(ctx context.Context, delivery amqp.Delivery) error {
+            return d.handleDelivery(
+                ctx, delivery, func(ctx context.Context, retry *webhookRetry) error {
+                    retryQueue, err := declareWebhookRetryQueue(conn, queue, retry.attempt)
+                    if err != nil {
+                        return err
+                    }
+                    return conn.Publish(ctx, "", retryQueue, retry.message)
+                },
+            )
+        },
+    )
+}
+
+// declareWebhookRetryQueue declares the retry queue of the attempt, a queue per attempt keeps
+// the short backoffs from waiting behind the long ones, since expired messages only leave at the head
+func declareWebhookRetryQueue(conn *RabbitConnection, queue string, attempt int) (string, error) {
+    channel, err := conn.Channel()
+    if err != nil {
+        return "", err
+    }
+    name := queue + ".retry." + strconv.Itoa(attempt)
+    _, err = channel.QueueDeclare(
+        name, true, false, false, false, amqp.Table{
+            "x-dead-letter-exchange":    "",
+            "x-dead-letter-routing-key": queue,
+        },
+    )
+    return name, err
+}
+
+// handleDelivery attempts the endpoints of the delivery once and publishes the retry of the failed ones,
+// an error requeues the delivery, so it is only returned before any endpoint was attempted
+// or if the retry couldn't be published
+func (d *WebhookDispatcher) handleDelivery(
+    ctx context.Context,
+    delivery amqp.Delivery,
+    publish func(ctx context.Context, retry *webhookRetry) error,
+) error {
+    var event WebhookEvent
+    if err := json.Unmarshal(delivery.Body, &event); err != nil {
+        // requeueing a malformed message would loop forever
+        log.Println("Failed to decode webhook event", err)
+        return nil
+    }
+
+    prepared, body, err := d.prepare(ctx, &event)
+    if err != nil {
+        log.Println("Failed to encode webhook event", err)
+        return nil
+    }
+
+    endpoints, err := d.store.Endpoints(ctx, prepared)
+    if err != nil {
+        return err
+    }
+
+    // a retry only goes to the endpoints that are left, the others already have the event
+    attempt := 1
+    if pending, ok := delivery.Headers[webhookEndpointsHeader].(string); ok {
+        ids := strings.Split(pending, ",")
+        endpoints = slices.DeleteFunc(
+            endpoints, func(endpoint *WebhookEndpoint) bool {
+                return !slices.Contains(ids, endpoint.ID)
+            },
+        )
+        attempt = webhookAttempt(delivery.Headers[webhookAttemptHeader])
+    }
+
+    var wg sync.WaitGroup
+    retries := make([]bool, len(endpoints))
+    for i, endpoint := range endpoints {
+        wg.Add(1)
+        go func(i int, endpoint *WebhookEndpoint) {
+            defer wg.Done()
+            record, retry, err := d.attempt(ctx, endpoint, prepared, body, attempt)
+            switch {
+            case err != nil:
+                // the context is done, the endpoint is attempted again with the retry
+                retries[i] = true
+            case record.Delivered:
+            case retry && attempt < d.config.MaxAttempts:
+                retries[i] = true
+            default:
+                log.Println(deliveryFailed(prepared, endpoint, record))
+            }
+        }(i, endpoint)
+    }
+    wg.Wait()
+
+    var pending []string
+    for i, endpoint := range endpoints {
+        if retries[i] {
+            pending = append(pending, endpoint.ID)
+        }
+    }
+    if len(pending) == 0 {
+        return nil
+    }
+
+    delay := d.config.Backoff(attempt)
+    return publish(
+        ctx, &webhookRetry{
+            attempt: attempt + 1,
+            message: amqp.Publishing{
+                ContentType:  ApplicationJSON,
+                DeliveryMode: amqp.Persistent,
+                Expiration:   strconv.FormatInt(delay.Milliseconds(), 10),
+                Headers: amqp.Table{
+                    webhookEndpointsHeader: strings.Join(pending, ","),
+                    webhookAttemptHeader:   int32(attempt + 1),
+                },
+                Body: body,
+            },
+        },
+    )
+}
+
+// webhookAttempt reads the attempt header, the integer type depends on who published the message
+func webhookAttempt(value any) int {
+    switch v := value.(type) {
+    case int32:
+        return int(v)
+    case int64:
+        return int(v)
+    case int:
+        return v
+    }
+    return 1
+}
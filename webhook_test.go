@@ -0,0 +1,217 @@
+package common
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/goccy/go-json"
+    amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+func noBackoff(int) time.Duration {
+    return 0
+}
+
+func newTestWebhookEvent() *WebhookEvent {
+    return &WebhookEvent{
+        ID:        "evt-1",
+        Type:      "geofence.exited",
+        CreatedAt: time.Now(),
+        Data:      []byte("{\"vehicle_id\":\"v-1\"}"),
+    }
+}
+
+func TestWebhookDispatcher_Dispatch(t *testing.T) {
+    var calls atomic.Int32
+    server := httptest.NewServer(
+        VerifySignatureMiddleware(testWebhookSecret)(
+            http.HandlerFunc(
+                func(w http.ResponseWriter, r *http.Request) {
+                    // the first attempt fails, so the delivery must be retried
+                    if calls.Add(1) == 1 {
+                        w.WriteHeader(http.StatusServiceUnavailable)
+                        return
+                    }
+                    if r.Header.Get(XWebhookEventType) != "geofence.exited" {
+                        t.Errorf("Event type should be sent")
+                    }
+                    w.WriteHeader(http.StatusNoContent)
+                },
+            ),
+        ),
+    )
+    defer server.Close()
+
+    store := NewMemoryWebhookStore(
+        &WebhookEndpoint{ID: "ep-1", URL: server.URL, Secret: testWebhookSecret},
+        &WebhookEndpoint{ID: "ep-2", URL: server.URL, Secret: testWebhookSecret, Events: []string{"alert.raised"}},
+    )
+    dispatcher := NewWebhookDispatcher(store, &WebhookConfig{Backoff: noBackoff})
+
+    if err := dispatcher.Dispatch(context.Background(), newTestWebhookEvent()); err != nil {
+        t.Fatal(err)
+    }
+
+    attempts := store.Attempts()
+    if len(attempts) != 2 {
+        t.Fatalf("Attempts should be 2, got %d", len(attempts))
+    }
+    if attempts[0].Delivered || !attempts[1].Delivered {
+        t.Fatal("Only the second attempt should be delivered")
+    }
+}
+
+func TestWebhookDispatcher_Dispatch_MustFail(t *testing.T) {
+    var calls atomic.Int32
+    server := httptest.NewServer(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                calls.Add(1)
+                if r.URL.Path == "/gone" {
+                    w.WriteHeader(http.StatusGone)
+                    return
+                }
+                w.WriteHeader(http.StatusInternalServerError)
+            },
+        ),
+    )
+    defer server.Close()
+
+    store := NewMemoryWebhookStore(
+        &WebhookEndpoint{ID: "ep-1", URL: server.URL, Secret: testWebhookSecret},
+        &WebhookEndpoint{ID: "ep-2", URL: server.URL + "/gone", Secret: testWebhookSecret},
+    )
+    dispatcher := NewWebhookDispatcher(store, &WebhookConfig{MaxAttempts: 3, Backoff: noBackoff})
+
+    err := dispatcher.Dispatch(context.Background(), newTestWebhookEvent())
+    if !errors.Is(err, ErrWebhookDeliveryFailed) {
+        t.Fatalf("Delivery should fail, got %v", err)
+    }
+
+    // 3 attempts to the failing endpoint and a single one to the gone endpoint
+    if calls.Load() != 4 {
+        t.Fatalf("Calls should be 4, got %d", calls.Load())
+    }
+    if len(store.Attempts()) != 4 {
+        t.Fatalf("Attempts should be 4, got %d", len(store.Attempts()))
+    }
+}
+
+func TestWebhookDispatcher_MaxConcurrency(t *testing.T) {
+    var inFlight, maxInFlight atomic.Int32
+    server := httptest.NewServer(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                current := inFlight.Add(1)
+                defer inFlight.Add(-1)
+                for {
+                    observed := maxInFlight.Load()
+                    if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+                        break
+                    }
+                }
+                time.Sleep(20 * time.Millisecond)
+                w.WriteHeader(http.StatusOK)
+            },
+        ),
+    )
+    defer server.Close()
+
+    store := NewMemoryWebhookStore(
+        &WebhookEndpoint{ID: "ep-1", URL: server.URL, Secret: testWebhookSecret, MaxConcurrency: 1},
+    )
+    dispatcher := NewWebhookDispatcher(store, nil)
+
+    done := make(chan error, 3)
+    for i := 0; i < 3; i++ {
+        go func() {
+            done <- dispatcher.Dispatch(context.Background(), newTestWebhookEvent())
+        }()
+    }
+    for i := 0; i < 3; i++ {
+        if err := <-done; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    if maxInFlight.Load() != 1 {
+        t.Fatalf("Deliveries in flight should be 1, got %d", maxInFlight.Load())
+    }
+}
+
+func TestWebhookDispatcher_Dispatch_CopiesEvent(t *testing.T) {
+    server := httptest.NewServer(okHandler())
+    defer server.Close()
+
+    store := NewMemoryWebhookStore(&WebhookEndpoint{ID: "ep-1", URL: server.URL, Secret: testWebhookSecret})
+    dispatcher := NewWebhookDispatcher(store, &WebhookConfig{Backoff: noBackoff})
+
+    event := newTestWebhookEvent()
+    if err := dispatcher.Dispatch(WithTenant(context.Background(), "acme"), event); err != nil {
+        t.Fatal(err)
+    }
+    if event.TenantID != "" {
+        t.Fatalf("Event of the caller should not be modified, got tenant %s", event.TenantID)
+    }
+}
+
+func TestWebhookDispatcher_HandleDelivery(t *testing.T) {
+    var okCalls, failingCalls atomic.Int32
+    server := httptest.NewServer(
+        http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Path == "/failing" {
+                    failingCalls.Add(1)
+                    w.WriteHeader(http.StatusServiceUnavailable)
+                    return
+                }
+                okCalls.Add(1)
+                w.WriteHeader(http.StatusOK)
+            },
+        ),
+    )
+    defer server.Close()
+
+    store := NewMemoryWebhookStore(
+        &WebhookEndpoint{ID: "ep-1", URL: server.URL, Secret: testWebhookSecret},
+        &WebhookEndpoint{ID: "ep-2", URL: server.URL + "/failing", Secret: testWebhookSecret},
+    )
+    dispatcher := NewWebhookDispatcher(store, &WebhookConfig{MaxAttempts: 2, Backoff: noBackoff})
+
+    body, err := json.Marshal(newTestWebhookEvent())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var retries []*webhookRetry
+    publish := func(ctx context.Context, retry *webhookRetry) error {
+        retries = append(retries, retry)
+        return nil
+    }
+
+    if err := dispatcher.handleDelivery(context.Background(), amqp.Delivery{Body: body}, publish); err != nil {
+        t.Fatal(err)
+    }
+    if len(retries) != 1 || retries[0].attempt != 2 || retries[0].message.Headers[webhookEndpointsHeader] != "ep-2" {
+        t.Fatalf("Only the failing endpoint should be retried, got %+v", retries)
+    }
+
+    // the retry only goes to the failing endpoint, which runs out of attempts
+    retry := amqp.Delivery{Headers: retries[0].message.Headers, Body: retries[0].message.Body}
+    if err := dispatcher.handleDelivery(context.Background(), retry, publish); err != nil {
+        t.Fatal(err)
+    }
+    if okCalls.Load() != 1 || failingCalls.Load() != 2 {
+        t.Fatalf("Delivered endpoint should not get the retry, got %d and %d calls", okCalls.Load(), failingCalls.Load())
+    }
+    if len(retries) != 1 {
+        t.Fatalf("Endpoint out of attempts should not be retried, got %d retries", len(retries))
+    }
+}